@@ -4,24 +4,96 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Quit this will close the current tab or view that is open
 func (v *View) Quit() bool {
-	v.CloseBuffer()
+	if t := tabs[v.TabNum]; len(t.Views) > 1 {
+		// Only the split is closed
+		CancelFind(v)
+		ClearMatches(v)
+		t.CloseView(v)
+		v.CloseBuffer()
+		return false
+	}
+	if len(tabs) > 1 {
+		CloseTab(v.TabNum)
+		return false
+	}
+	return v.QuitAll()
+}
+
+// QuitAll closes every tab and exits
+func (v *View) QuitAll() bool {
+	for _, v := range allViews() {
+		// Closing a buffer twice does nothing, splits may share one
+		v.Buf.Close()
+	}
 	screen.Fini()
 	os.Exit(0)
 
 	return false
 }
 
+// NextTab switches to the next tab
+func (v *View) NextTab() bool {
+	SwitchTab(curTab + 1)
+	return false
+}
+
+// PreviousTab switches to the previous tab
+func (v *View) PreviousTab() bool {
+	SwitchTab(curTab - 1)
+	return false
+}
+
+// NextSplit moves to the next split of the tab
+func (v *View) NextSplit() bool {
+	t := tabs[curTab]
+	t.CurView = (t.CurView + 1) % len(t.Views)
+	return false
+}
+
+// PreviousSplit moves to the previous split of the tab
+func (v *View) PreviousSplit() bool {
+	t := tabs[curTab]
+	t.CurView = (t.CurView - 1 + len(t.Views)) % len(t.Views)
+	return false
+}
+
+// HSplitAction opens a horizontal split of the current log
+func (v *View) HSplitAction() bool {
+	v.HSplit(v.Buf)
+	return false
+}
+
+// VSplitAction opens a vertical split of the current log
+func (v *View) VSplitAction() bool {
+	v.VSplit(v.Buf)
+	return false
+}
+
+// OpenFile asks for files to open in a new tab
+func (v *View) OpenFile() bool {
+	input, canceled := messenger.Prompt("Open file: ", "", "Open", FileCompletion)
+	if canceled || strings.TrimSpace(input) == "" {
+		return false
+	}
+	OpenTab(SplitCommandArgs(input))
+	return false
+}
+
 // UpN moves the cursor up by amount
 func (v *View) UpN(amount int) bool {
 	proposedY := v.Line - amount
+	if proposedY >= v.NumRows()-1 {
+		proposedY = v.NumRows() - 1
+	}
 	if proposedY < 0 {
 		proposedY = 0
-	} else if proposedY >= v.Buf.NumLines-1 {
-		proposedY = v.Buf.NumLines - 1
 	}
 
 	v.Line = proposedY
@@ -46,12 +118,12 @@ func (v *View) Up() bool {
 
 // PageUp scrolls the view up a page
 func (v *View) PageUp() bool {
-	return v.UpN(v.Height)
+	return v.UpN(v.listHeight())
 }
 
 // PageDown scrolls the view down a page
 func (v *View) PageDown() bool {
-	return v.DownN(v.Height)
+	return v.DownN(v.listHeight())
 }
 
 // End moves the cursor to the end of the buffer
@@ -62,7 +134,7 @@ func (v *View) Start() bool {
 
 // End moves the cursor to the end of the buffer
 func (v *View) End() bool {
-	v.Line = v.Buf.End()
+	v.Line = Max(v.NumRows()-1, 0)
 	return true
 }
 
@@ -76,19 +148,22 @@ func (v *View) Find() bool {
 // FindNext searches forwards for the last used search term
 func (v *View) FindNext() bool {
 	searchStart = v.Line + 1
-	if lastSearch == "" {
+	if v.lastSearch == "" {
 		return true
 	}
-	messenger.Message("Finding: " + lastSearch)
-	Search(lastSearch, v, true)
+	messenger.Message("Finding: " + v.lastSearch)
+	Search(v.lastSearch, v, true)
 	return true
 }
 
 // FindPrevious searches backwards for the last used search term
 func (v *View) FindPrevious() bool {
 	searchStart = v.Line
-	messenger.Message("Finding: " + lastSearch)
-	Search(lastSearch, v, false)
+	if v.lastSearch == "" {
+		return true
+	}
+	messenger.Message("Finding: " + v.lastSearch)
+	Search(v.lastSearch, v, false)
 	return true
 }
 
@@ -105,16 +180,408 @@ func (v *View) JumpLine() bool {
 		return false
 	}
 	lineint, err := strconv.Atoi(linestring)
-	lineint = lineint - 1 // fix offset
 	if err != nil {
 		messenger.Error(err) // return errors
 		return false
 	}
+	return v.GotoLine(lineint)
+}
+
+// GotoLine moves the cursor to a line of the buffer, starting at 1. When
+// the line is hidden the cursor goes to the next line that is shown
+func (v *View) GotoLine(lineint int) bool {
+	lineint = lineint - 1 // fix offset
 	// Move cursor and view if possible.
 	if lineint < v.Buf.NumLines && lineint >= 0 {
-		v.Line = lineint
+		v.Line = v.RowOf(lineint)
 		return true
 	}
 	messenger.Error("Only ", v.Buf.NumLines, " lines to jump")
 	return false
 }
+
+// ParseSummary shows how many lines could not be parsed as log entries.
+// The lines are checked in the background, those of an indexed file are
+// read from the file again
+func (v *View) ParseSummary() bool {
+	snap := newLineSnapshot(v.Buf.LineArray)
+	var invalid, notObject int64
+	failed := func(line *Line) bool {
+		switch line.status {
+		case ParseInvalid:
+			atomic.AddInt64(&invalid, 1)
+		case ParseNotObject:
+			atomic.AddInt64(&notObject, 1)
+		default:
+			return false
+		}
+		return true
+	}
+	scan := NewFilterScan(snap, failed, &v.summaryCount)
+	job := &SummaryJob{total: snap.Len()}
+	v.summarizing = job
+
+	go func() {
+		var rows []int
+		found := func(chunkRows []int) bool {
+			rows = append(rows, chunkRows...)
+			return true
+		}
+		progress := func(scanned int) {
+			jobs <- JobFunction{func(output string, args ...string) {
+				if !scan.Cancelled() {
+					job.scanned = scanned
+				}
+			}, "", nil}
+		}
+		if !scan.Run(rowRange{0, snap.Len(), false}.chunks(), found, progress) {
+			return
+		}
+
+		summary := NewParseSummary(snap.Len(), map[ParseStatus]int{
+			ParseInvalid:   int(atomic.LoadInt64(&invalid)),
+			ParseNotObject: int(atomic.LoadInt64(&notObject)),
+		})
+		for _, row := range rows {
+			if summary.SetFirst(row, snap.Lines(row, row+1, true)[0]) {
+				break
+			}
+		}
+		jobs <- JobFunction{func(output string, args ...string) {
+			if !scan.Cancelled() {
+				v.summarizing = nil
+				messenger.Message(summary.String())
+			}
+		}, "", nil}
+	}()
+	return false
+}
+
+// ToggleDetail opens or closes the pane showing the whole selected entry
+func (v *View) ToggleDetail() bool {
+	if v.detail != nil {
+		v.detail.Close()
+		v.detail = nil
+	} else {
+		v.detail = NewDetailPane(v, false)
+	}
+	return true
+}
+
+// RotateDetail moves the detail pane between the bottom and the right side
+// of the view, opening it on the right if it is closed
+func (v *View) RotateDetail() bool {
+	vertical := true
+	if v.detail != nil {
+		vertical = !v.detail.vertical
+		v.detail.Close()
+	}
+	v.detail = NewDetailPane(v, vertical)
+	return true
+}
+
+// DetailScrollDown scrolls the detail pane down one line
+func (v *View) DetailScrollDown() bool {
+	if v.detail != nil {
+		v.detail.Scroll(1)
+	}
+	return false
+}
+
+// DetailScrollUp scrolls the detail pane up one line
+func (v *View) DetailScrollUp() bool {
+	if v.detail != nil {
+		v.detail.Scroll(-1)
+	}
+	return false
+}
+
+// Filter asks for a filter expression and hides the lines that don't
+// match it. An empty expression removes the filter
+func (v *View) Filter() bool {
+	text := ""
+	if v.filter != nil {
+		text = v.filter.String()
+	}
+	input, canceled := messenger.Prompt("Filter: ", text, "Filter", NoCompletion)
+	if canceled {
+		return false
+	}
+	return v.ApplyFilter(input)
+}
+
+// ApplyFilter parses a filter expression and hides the lines that don't
+// match it. An empty expression removes the filter
+func (v *View) ApplyFilter(input string) bool {
+	if strings.TrimSpace(input) == "" {
+		return v.ClearFilter()
+	}
+
+	q, err := ParseQuery(input)
+	if err != nil {
+		messenger.Error("Filter: ", err)
+		return false
+	}
+	v.SetFilter(q)
+	messenger.Message(v.NumRows(), " of ", v.Buf.NumLines, " lines match")
+	return true
+}
+
+// ClearFilter shows all the lines again
+func (v *View) ClearFilter() bool {
+	if v.filter != nil {
+		v.SetFilter(nil)
+		messenger.Message("Filter cleared")
+	}
+	return true
+}
+
+// JumpTime asks for a time and moves the cursor to the first entry at or
+// after it
+func (v *View) JumpTime() bool {
+	input, canceled := messenger.Prompt("Jump to time (14:32, 2024-05-01T14:32Z, -15m) # ", "", "Time", NoCompletion)
+	if canceled || strings.TrimSpace(input) == "" {
+		return false
+	}
+	return v.GotoTime(input)
+}
+
+// GotoTime moves the cursor to the first entry at or after a time typed
+// by the user
+func (v *View) GotoTime(input string) bool {
+	t, err := ParseTimeInput(input, v.CurrentTime())
+	if err != nil {
+		messenger.Error(err)
+		return false
+	}
+	if v.NumRows() == 0 {
+		return false
+	}
+	v.Line = v.FindTime(t)
+	return true
+}
+
+// TimeWindow asks for a time window such as 14:00..14:30 and only shows
+// the entries inside it. An empty window shows all the entries again
+func (v *View) TimeWindow() bool {
+	text := ""
+	if v.HasTimeWindow() {
+		text = formatTimeWindow(v.since, v.until)
+	}
+	input, canceled := messenger.Prompt("Time window (since..until): ", text, "TimeWindow", NoCompletion)
+	if canceled {
+		return false
+	}
+	if strings.TrimSpace(input) == "" {
+		v.SetTimeWindow(time.Time{}, time.Time{})
+		messenger.Message("Time window cleared")
+		return true
+	}
+	since, until, err := ParseTimeWindow(input, v.CurrentTime())
+	if err != nil {
+		messenger.Error(err)
+		return false
+	}
+	v.SetTimeWindow(since, until)
+	messenger.Message(v.NumRows(), " of ", v.Buf.NumLines, " lines in the time window")
+	return true
+}
+
+// CycleTimeDisplay switches the timestamps between UTC, local time and
+// the time relative to now
+func (v *View) CycleTimeDisplay() bool {
+	for i, mode := range timeDisplayModes {
+		if mode == GetOption("time") {
+			OverrideOption("time", timeDisplayModes[(i+1)%len(timeDisplayModes)])
+			break
+		}
+	}
+	messenger.Message("Showing times in ", GetOption("time"), " time")
+	return true
+}
+
+// ToggleDelta shows or hides the time since the previous line
+func (v *View) ToggleDelta() bool {
+	toggleDeltaColumn()
+	OverrideOption("delta", strconv.FormatBool(hasDeltaColumn()))
+	return true
+}
+
+// SelectNextColumn selects the column to the right of the selected one
+func (v *View) SelectNextColumn() bool {
+	if selectedColumn < len(columns)-1 {
+		selectedColumn++
+	}
+	return true
+}
+
+// SelectPreviousColumn selects the column to the left of the selected one
+func (v *View) SelectPreviousColumn() bool {
+	if selectedColumn > 0 {
+		selectedColumn--
+	}
+	return true
+}
+
+// MoveColumnRight swaps the selected column with the one to its right
+func (v *View) MoveColumnRight() bool {
+	if selectedColumn < len(columns)-1 {
+		columns[selectedColumn], columns[selectedColumn+1] = columns[selectedColumn+1], columns[selectedColumn]
+		selectedColumn++
+	}
+	return true
+}
+
+// MoveColumnLeft swaps the selected column with the one to its left
+func (v *View) MoveColumnLeft() bool {
+	if selectedColumn > 0 {
+		columns[selectedColumn], columns[selectedColumn-1] = columns[selectedColumn-1], columns[selectedColumn]
+		selectedColumn--
+	}
+	return true
+}
+
+// AddColumn asks for the path of a field, and optionally its width, and
+// adds a column for it after the selected one
+func (v *View) AddColumn() bool {
+	input, canceled := messenger.Prompt("Add column (path [width]): ", "", "Column", NoCompletion)
+	if canceled {
+		return false
+	}
+	args := strings.Fields(input)
+	if len(args) == 0 || len(args) > 2 {
+		return false
+	}
+	c := &Column{Path: args[0], Width: 16}
+	if len(args) == 2 {
+		width, err := strconv.Atoi(args[1])
+		if err != nil || width < 0 {
+			messenger.Error("Invalid width ", args[1])
+			return false
+		}
+		c.Width = width
+	}
+
+	i := Min(selectedColumn+1, len(columns))
+	columns = append(columns[:i], append([]*Column{c}, columns[i:]...)...)
+	selectedColumn = i
+	return true
+}
+
+// RemoveColumn removes the selected column, the last column can't be removed
+func (v *View) RemoveColumn() bool {
+	if len(columns) <= 1 {
+		messenger.Error("Can't remove the last column")
+		return false
+	}
+	columns = append(columns[:selectedColumn], columns[selectedColumn+1:]...)
+	if selectedColumn >= len(columns) {
+		selectedColumn = len(columns) - 1
+	}
+	return true
+}
+
+// RaiseMinLevel hides the least severe level that is still shown
+func (v *View) RaiseMinLevel() bool {
+	if v.minLevel < LevelFatal {
+		v.setMinLevel(v.minLevel + 1)
+	}
+	return true
+}
+
+// LowerMinLevel shows the next less severe level again
+func (v *View) LowerMinLevel() bool {
+	if v.minLevel > LevelUnknown {
+		v.setMinLevel(v.minLevel - 1)
+	}
+	return true
+}
+
+// MinLevel asks for the least severe level to show, such as warn+
+func (v *View) MinLevel() bool {
+	text := ""
+	if v.minLevel != LevelUnknown {
+		text = v.minLevel.String() + "+"
+	}
+	input, canceled := messenger.Prompt("Minimum level: ", text, "Level", NoCompletion)
+	if canceled {
+		return false
+	}
+	l, ok := ParseLevelInput(input)
+	if !ok {
+		messenger.Error("Unknown level ", input)
+		return false
+	}
+	v.setMinLevel(l)
+	return true
+}
+
+// setMinLevel sets the minimum level and tells the user how many lines
+// are left
+func (v *View) setMinLevel(l Level) {
+	v.SetMinLevel(l)
+	if l <= LevelTrace {
+		messenger.Message("Showing all levels")
+		return
+	}
+	messenger.Message("Showing ", l, "+: ", v.NumRows(), " of ", v.Buf.NumLines, " lines")
+}
+
+// ToggleSources asks for the names of merged files whose lines are hidden
+// or shown again
+func (v *View) ToggleSources() bool {
+	if len(v.Buf.Sources) == 0 {
+		messenger.Error("Only merged files have sources")
+		return false
+	}
+	names := make([]string, len(v.Buf.Sources))
+	for i, s := range v.Buf.Sources {
+		names[i] = s.Name
+	}
+	input, canceled := messenger.Prompt("Toggle sources ("+strings.Join(names, ", ")+"): ", "", "Source", SourceCompletion)
+	if canceled {
+		return false
+	}
+	return v.toggleSources(strings.Fields(input))
+}
+
+// toggleSources hides or shows the lines of the merged files with the
+// given names and tells the user how many lines are left
+func (v *View) toggleSources(names []string) bool {
+	var sources []*Source
+	for _, name := range names {
+		s := v.Buf.FindSource(name)
+		if s == nil {
+			messenger.Error("Unknown source ", name)
+			return false
+		}
+		sources = append(sources, s)
+	}
+	for _, s := range sources {
+		v.ToggleSource(s)
+	}
+	if len(v.hiddenSources) == 0 {
+		messenger.Message("Showing all sources")
+		return true
+	}
+	messenger.Message("Showing ", strings.Join(v.ShownSources(), ", "), ": ", v.NumRows(), " of ", v.Buf.NumLines, " lines")
+	return true
+}
+
+// Colorscheme asks for the name of a colorscheme and switches to it
+func (v *View) Colorscheme() bool {
+	input, canceled := messenger.Prompt("Colorscheme ("+strings.Join(ColorschemeNames(), ", ")+"): ", colorschemeName, "Colorscheme", NoCompletion)
+	if canceled {
+		return false
+	}
+	return SetColorscheme(strings.Fields(input))
+}
+
+// CommandMode lets the user enter a command
+func (v *View) CommandMode() bool {
+	input, canceled := messenger.Prompt(":", "", "Command", CommandCompletion)
+	if !canceled {
+		HandleCommand(input)
+	}
+	return true
+}
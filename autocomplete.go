@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FileComplete autocompletes filenames
+func FileComplete(input string) (string, []string) {
+	var sep string = string(os.PathSeparator)
+	dirs := strings.Split(input, sep)
+
+	var files []os.FileInfo
+	var err error
+	if len(dirs) > 1 {
+		directories := strings.Join(dirs[:len(dirs)-1], sep) + sep
+
+		directories = ReplaceHome(directories)
+		files, err = ioutil.ReadDir(directories)
+	} else {
+		files, err = ioutil.ReadDir(".")
+	}
+
+	var suggestions []string
+	if err != nil {
+		return "", suggestions
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			name += sep
+		}
+		if strings.HasPrefix(name, dirs[len(dirs)-1]) {
+			suggestions = append(suggestions, name)
+		}
+	}
+
+	var chosen string
+	if len(suggestions) == 1 {
+		if len(dirs) > 1 {
+			chosen = strings.Join(dirs[:len(dirs)-1], sep) + sep + suggestions[0]
+		} else {
+			chosen = suggestions[0]
+		}
+	} else {
+		if len(dirs) > 1 {
+			chosen = strings.Join(dirs[:len(dirs)-1], sep) + sep
+		}
+	}
+
+	return chosen, suggestions
+}
+
+// CommandComplete autocompletes commands
+func CommandComplete(input string) (string, []string) {
+	var suggestions []string
+	for cmd := range commands {
+		if strings.HasPrefix(cmd, input) {
+			suggestions = append(suggestions, cmd)
+		}
+	}
+	return completeFrom(suggestions)
+}
+
+// OptionComplete autocompletes options
+func OptionComplete(input string) (string, []string) {
+	var suggestions []string
+	for _, option := range OptionNames() {
+		if strings.HasPrefix(option, input) {
+			suggestions = append(suggestions, option)
+		}
+	}
+	return completeFrom(suggestions)
+}
+
+// OptionValueComplete autocompletes the values of an option
+func OptionValueComplete(inputOpt, input string) (string, []string) {
+	var suggestions []string
+	for _, value := range OptionValues(inputOpt) {
+		if strings.HasPrefix(value, input) {
+			suggestions = append(suggestions, value)
+		}
+	}
+	return completeFrom(suggestions)
+}
+
+// ColorschemeComplete autocompletes the names of colorschemes
+func ColorschemeComplete(input string) (string, []string) {
+	var suggestions []string
+	for _, name := range ColorschemeNames() {
+		if strings.HasPrefix(name, input) {
+			suggestions = append(suggestions, name)
+		}
+	}
+	return completeFrom(suggestions)
+}
+
+// SourceComplete autocompletes the names of the files merged into the
+// current buffer
+func SourceComplete(input string) (string, []string) {
+	var suggestions []string
+	for _, s := range CurView().Buf.Sources {
+		if strings.HasPrefix(s.Name, input) {
+			suggestions = append(suggestions, s.Name)
+		}
+	}
+	return completeFrom(suggestions)
+}
+
+// completeFrom returns the suggestion that is chosen when there is only one
+// along with the suggestions
+func completeFrom(suggestions []string) (string, []string) {
+	sort.Strings(suggestions)
+	var chosen string
+	if len(suggestions) == 1 {
+		chosen = suggestions[0]
+	}
+	return chosen, suggestions
+}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/flynn/json5"
 	"github.com/zyedidia/tcell"
 )
 
@@ -17,11 +24,43 @@ var bindingActions = map[string]func(*View) bool{
 	"Start":        (*View).Start,
 	"End":          (*View).End,
 	"Quit":         (*View).Quit,
+	"QuitAll":      (*View).QuitAll,
+	"NextTab":      (*View).NextTab,
+	"PreviousTab":  (*View).PreviousTab,
+	"OpenFile":     (*View).OpenFile,
 	"Find":         (*View).Find,
 	"FindNext":     (*View).FindNext,
 	"FindPrevious": (*View).FindPrevious,
 	"ClearStatus":  (*View).ClearStatus,
 	"JumpLine":     (*View).JumpLine,
+	"ParseSummary": (*View).ParseSummary,
+
+	"ToggleDetail":         (*View).ToggleDetail,
+	"RotateDetail":         (*View).RotateDetail,
+	"DetailScrollDown":     (*View).DetailScrollDown,
+	"DetailScrollUp":       (*View).DetailScrollUp,
+	"Filter":               (*View).Filter,
+	"ClearFilter":          (*View).ClearFilter,
+	"JumpTime":             (*View).JumpTime,
+	"TimeWindow":           (*View).TimeWindow,
+	"CycleTimeDisplay":     (*View).CycleTimeDisplay,
+	"CommandMode":          (*View).CommandMode,
+	"Colorscheme":          (*View).Colorscheme,
+	"ToggleDelta":          (*View).ToggleDelta,
+	"SelectNextColumn":     (*View).SelectNextColumn,
+	"SelectPreviousColumn": (*View).SelectPreviousColumn,
+	"MoveColumnRight":      (*View).MoveColumnRight,
+	"MoveColumnLeft":       (*View).MoveColumnLeft,
+	"AddColumn":            (*View).AddColumn,
+	"RemoveColumn":         (*View).RemoveColumn,
+	"RaiseMinLevel":        (*View).RaiseMinLevel,
+	"LowerMinLevel":        (*View).LowerMinLevel,
+	"MinLevel":             (*View).MinLevel,
+	"ToggleSources":        (*View).ToggleSources,
+	"NextSplit":            (*View).NextSplit,
+	"PreviousSplit":        (*View).PreviousSplit,
+	"HSplit":               (*View).HSplitAction,
+	"VSplit":               (*View).VSplitAction,
 }
 
 var bindingKeys = map[string]tcell.Key{
@@ -166,34 +205,67 @@ type Key struct {
 }
 
 // InitBindings initializes the keybindings for micro
-func InitBindings() {
+// InitBindings binds the default keys and then the ones in bindings.json
+// in the config directory over them. The problems found in bindings.json
+// are returned so they can be shown once the messenger is up
+func InitBindings() []error {
 	bindings = make(map[Key][]func(*View) bool)
+	errs := parseBindings(DefaultBindings())
 
-	var parsed map[string]string
-	defaults := DefaultBindings()
-
-	// filename := configDir + "/bindings.json"
-	// if _, e := os.Stat(filename); e == nil {
-	// 	input, err := ioutil.ReadFile(filename)
-	// 	if err != nil {
-	// 		TermMessage("Error reading bindings.json file: " + err.Error())
-	// 		return
-	// 	}
-
-	// 	err = json5.Unmarshal(input, &parsed)
-	// 	if err != nil {
-	// 		TermMessage("Error reading bindings.json:", err.Error())
-	// 	}
-	// }
+	parsed, err := readBindings()
+	if err != nil {
+		return append(errs, err)
+	}
+	return append(errs, parseBindings(parsed)...)
+}
+
+// ReloadBindings reads bindings.json again and replaces the bindings. If
+// the file can't be read the current bindings are kept
+func ReloadBindings() []error {
+	parsed, err := readBindings()
+	if err != nil {
+		return []error{err}
+	}
+	bindings = make(map[Key][]func(*View) bool)
+	helpBinding = ""
+	errs := parseBindings(DefaultBindings())
+	return append(errs, parseBindings(parsed)...)
+}
+
+// readBindings reads the user's bindings from bindings.json, there are none
+// if the file doesn't exist
+func readBindings() (map[string]string, error) {
+	filename := filepath.Join(configDir, "bindings.json")
+	input, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.New("Error reading bindings.json file: " + err.Error())
+	}
 
-	parseBindings(defaults)
-	parseBindings(parsed)
+	var parsed map[string]string
+	if err := json5.Unmarshal(input, &parsed); err != nil {
+		return nil, errors.New("Error reading bindings.json: " + err.Error())
+	}
+	return parsed, nil
 }
 
-func parseBindings(userBindings map[string]string) {
-	for k, v := range userBindings {
-		BindKey(k, v)
+// parseBindings binds the keys of a map of bindings, in a fixed order so
+// that the same file always gives the same result
+func parseBindings(userBindings map[string]string) []error {
+	keys := make([]string, 0, len(userBindings))
+	for k := range userBindings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, k := range keys {
+		if err := BindKey(k, userBindings[k]); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errs
 }
 
 // findKey will find binding Key 'b' using string 'k'
@@ -205,8 +277,9 @@ func findKey(k string) (b Key, ok bool) {
 modSearch:
 	for {
 		switch {
-		case strings.HasPrefix(k, "-"):
-			// We optionally support dashes between modifiers
+		case strings.HasPrefix(k, "-") && k != "-":
+			// We optionally support dashes between modifiers, a dash on
+			// its own is the minus key
 			k = k[1:]
 		case strings.HasPrefix(k, "Ctrl") && k != "CtrlH":
 			// CtrlH technically does not have a 'Ctrl' modifier because it is really backspace
@@ -275,12 +348,23 @@ func findAction(v string) (action func(*View) bool) {
 }
 
 // BindKey takes a key and an action and binds the two together
-func BindKey(k, v string) {
+// Nothing is bound if the key or one of the actions is unknown
+func BindKey(k, v string) error {
 	key, ok := findKey(k)
 	if !ok {
-		TermMessage("Unknown keybinding: " + k)
-		return
+		return errors.New("Unknown keybinding: " + k)
 	}
+
+	actionNames := strings.Split(v, ",")
+	for i, actionName := range actionNames {
+		if i == 0 && actionName == "UnbindKey" {
+			continue
+		}
+		if findAction(actionName) == nil {
+			return errors.New("Unknown action " + strconv.Quote(actionName) + " bound to " + k)
+		}
+	}
+
 	if v == "ToggleHelp" {
 		helpBinding = k
 	}
@@ -288,11 +372,10 @@ func BindKey(k, v string) {
 		helpBinding = ""
 	}
 
-	actionNames := strings.Split(v, ",")
 	if actionNames[0] == "UnbindKey" {
 		delete(bindings, key)
 		if len(actionNames) == 1 {
-			return
+			return nil
 		}
 		actionNames = append(actionNames[:0], actionNames[1:]...)
 	}
@@ -304,6 +387,7 @@ func BindKey(k, v string) {
 	if len(actions) > 0 {
 		bindings[key] = actions
 	}
+	return nil
 }
 
 // DefaultBindings returns a map containing micro's default keybindings
@@ -318,14 +402,56 @@ func DefaultBindings() map[string]string {
 		"g":        "JumpLine",
 
 		"CtrlQ": "Quit",
-		"CtrlC": "Quit",
-		"Q":     "Quit",
+		"CtrlC": "QuitAll",
+		"Q":     "QuitAll",
 		"q":     "Quit",
 
+		"o":       "OpenFile",
+		"Tab":     "NextTab",
+		"Backtab": "PreviousTab",
+		"Alt.":    "NextTab",
+		"Alt,":    "PreviousTab",
+
+		"CtrlW": "NextSplit",
+		"Altw":  "PreviousSplit",
+		"H":     "HSplit",
+		"V":     "VSplit",
+
 		"/": "Find",
 		"n": "FindNext",
 		"N": "FindPrevious",
 
 		"Escape": "ClearStatus",
+
+		"p": "ParseSummary",
+
+		"d":     "ToggleDetail",
+		"Enter": "ToggleDetail",
+		"D":     "RotateDetail",
+		"J":     "DetailScrollDown",
+		"K":     "DetailScrollUp",
+
+		"f": "Filter",
+		"F": "ClearFilter",
+
+		"t": "JumpTime",
+		"w": "TimeWindow",
+		"z": "CycleTimeDisplay",
+
+		"]": "SelectNextColumn",
+		"[": "SelectPreviousColumn",
+		">": "MoveColumnRight",
+		"<": "MoveColumnLeft",
+		"c": "AddColumn",
+		"x": "RemoveColumn",
+
+		":": "CommandMode",
+		"s": "Colorscheme",
+
+		"+": "RaiseMinLevel",
+		"-": "LowerMinLevel",
+		"L": "MinLevel",
+		"Z": "ToggleDelta",
+		"S": "ToggleSources",
 	}
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/zyedidia/tcell"
+)
+
+func TestDefaultBindingsResolve(t *testing.T) {
+	bindings = make(map[Key][]func(*View) bool)
+	for k, v := range DefaultBindings() {
+		if err := BindKey(k, v); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFindKeyDash(t *testing.T) {
+	tests := []struct {
+		k         string
+		r         rune
+		modifiers tcell.ModMask
+	}{
+		{"-", '-', tcell.ModNone},
+		{"Alt--", '-', tcell.ModAlt},
+		{"Alt-w", 'w', tcell.ModAlt},
+	}
+	for _, test := range tests {
+		key, ok := findKey(test.k)
+		if !ok || key.keyCode != tcell.KeyRune || key.r != test.r || key.modifiers != test.modifiers {
+			t.Errorf("findKey(%q) = %+v, %v", test.k, key, ok)
+		}
+	}
+}
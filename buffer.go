@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/md5"
 	"io"
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -29,6 +30,8 @@ type Buffer struct {
 	name string
 
 	NumLines int
+	// Incremented every time data is appended
+	version int
 
 	Y int
 
@@ -39,6 +42,16 @@ type Buffer struct {
 
 	// Buffer local settings
 	Settings map[string]interface{}
+
+	// Keeps reading the file as it grows, nil if the buffer isn't followed
+	follower *Follower
+	// How the file was compressed, nil if it wasn't
+	compression *Compression
+	// The files merged into the buffer, nil if it holds a single file
+	Sources []*Source
+	// The column showing which file each line comes from, in front of the
+	// other columns. It belongs to the buffer and isn't saved with them
+	sourceColumn *Column
 }
 
 func NewBufferFromString(text, path string) *Buffer {
@@ -56,6 +69,7 @@ func NewBuffer(reader io.Reader, size int64, path string) *Buffer {
 	b.AbsPath = absPath
 
 	b.Update()
+	InitLocalSettings(b)
 
 	// Put the cursor at the first spot
 	cursorStartY := 0
@@ -71,6 +85,85 @@ func NewBuffer(reader io.Reader, size int64, path string) *Buffer {
 	return b
 }
 
+// NewBufferFromFile creates a buffer for a file. Files that are too large
+// to be read into memory are indexed in the background instead, the buffer
+// fills up as the index grows. Compressed files are decompressed as they
+// are read, they are always read into memory.
+// The offset returned is where a follower should carry on reading the file.
+// When the file can't be decompressed the buffer holds whatever could be
+// read from it and the error is returned
+func NewBufferFromFile(file *os.File, path string) (*Buffer, int64, error) {
+	size := FSize(file)
+	reader := &countingReader{r: file}
+	input, compression, err := Decompress(reader)
+	if err != nil {
+		return NewBufferFromString("", path), 0, err
+	}
+
+	if compression != nil {
+		// The size of the file says little about how many lines it has
+		b := NewBuffer(input, compression.DecompressedSize(file, size), path)
+		b.compression = compression
+		return b, reader.n, decompressErr(input)
+	}
+
+	if size >= indexThreshold {
+		// The index has its own file, a follower may close this one
+		if indexFile, err := os.Open(path); err == nil {
+			return NewIndexedBuffer(indexFile, size, path), size, nil
+		}
+	}
+	return NewBuffer(input, size, path), reader.n, nil
+}
+
+// NewIndexedBuffer creates a buffer for a large file which is indexed in
+// the background
+func NewIndexedBuffer(file *os.File, size int64, path string) *Buffer {
+	b := new(Buffer)
+	b.LineArray = NewIndexedLineArray(file, size)
+
+	absPath, _ := filepath.Abs(path)
+
+	b.Path = path
+	b.AbsPath = absPath
+
+	b.Update()
+	InitLocalSettings(b)
+	b.fastdirty = true
+
+	la := b.LineArray
+	la.index.Start(func(offsets []int64, indexed int64, done bool) {
+		if b.LineArray != la {
+			// The buffer was reset
+			return
+		}
+		la.addIndexed(offsets, indexed, done)
+		b.version++
+		b.Update()
+	})
+	return b
+}
+
+// Indexing returns whether the file of the buffer is still being indexed
+// and how far the index is, from 0 to 1
+func (b *Buffer) Indexing() (bool, float64) {
+	if b.index == nil || b.index.done {
+		return false, 1
+	}
+	return true, b.index.Progress()
+}
+
+// Close stops the work done in the background for the buffer
+func (b *Buffer) Close() {
+	if b.follower != nil {
+		b.follower.Stop()
+		b.follower = nil
+	}
+	if b.index != nil {
+		b.index.Stop()
+	}
+}
+
 // GetName returns buffer name
 func (b *Buffer) GetName() string {
 	if b.name == "" {
@@ -84,7 +177,23 @@ func (b *Buffer) GetName() string {
 
 // Update fetches the string from the rope and updates the `text` and `lines` in the buffer
 func (b *Buffer) Update() {
-	b.NumLines = len(b.lines)
+	b.NumLines = b.LineArray.Len()
+}
+
+// Append adds data that was read after the buffer was loaded
+func (b *Buffer) Append(data []byte) {
+	b.AppendBytes(data)
+	b.version++
+	b.Update()
+}
+
+// Reset removes all the lines from the buffer
+func (b *Buffer) Reset() {
+	if b.index != nil {
+		b.index.Stop()
+	}
+	b.LineArray = NewLineArray(0, strings.NewReader(""))
+	b.Update()
 }
 
 // Start returns the location of the first character in the buffer
@@ -108,23 +217,19 @@ func (b *Buffer) End() int {
 
 // Line returns a single line
 func (b *Buffer) Line(n int) Line {
-	if n >= len(b.lines) {
-		return NewLine([]byte(""))
-	}
-	return b.lines[n]
+	return b.LineArray.Line(n)
 }
 
 // LinesNum returns the number of lines
 func (b *Buffer) LinesNum() int {
-	return len(b.lines)
+	return b.LineArray.Len()
 }
 
 // Lines returns an array of strings containing the lines from start to end
 func (b *Buffer) Lines(start, end int) []string {
-	lines := b.lines[start:end]
 	var slice []string
-	for _, line := range lines {
-		slice = append(slice, string(line.data))
+	for n := start; n < end; n++ {
+		slice = append(slice, string(b.Line(n).data))
 	}
 	return slice
 }
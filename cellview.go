@@ -53,79 +53,131 @@ type Char struct {
 	drawChar rune
 	style    tcell.Style
 	width    int
+	// Whether the character is part of a search match
+	match bool
 }
 
 type CellView struct {
-	lines [][]*Char
+	// The column header
+	header []*Char
+	lines  [][]*Char
+	// The row of the view each line belongs to, with softwrap a row takes
+	// several lines
+	rows []int
 }
 
-func (c *CellView) Draw(buf *Buffer, top, height, left, width int) {
+// Draw lays out the column header and the rows of a view starting at top
+func (c *CellView) Draw(v *View, top, height, left, width int) {
+	buf := v.Buf
 	c.lines = make([][]*Char, 0)
+	c.rows = make([]int, 0)
+	softwrap := buf.Settings["softwrap"].(bool)
+	if width < 0 {
+		width = 0
+	}
+
+	cols := buf.Columns()
+	headerStr, headerStyles := formatHeader(cols)
+	c.header = c.layout(headerStr, headerStyles, nil, buf, left, width, -1, 0)
 
 	viewLine := 0
 	lineN := top
 
-	// curStyle := defStyle
 	for viewLine < height {
-		if lineN >= len(buf.lines) {
+		if lineN >= v.NumRows() {
 			break
 		}
 
-		lineObj := buf.Line(lineN)
-		lineStr := lineObj.String()
-		line := []rune(lineStr)
+		lineObj := buf.Line(v.BufLine(lineN))
+		var prev *Line
+		if lineN > 0 {
+			prevLine := buf.Line(v.BufLine(lineN - 1))
+			prev = &prevLine
+		}
+		lineStr, styles := formatLine(cols, &lineObj, prev)
+		matched := v.matches.Highlight(&lineObj, prev, lineStr, cols)
+		if matched != nil {
+			matchStyle := GetColor("search-match")
+			if lineN == v.Line {
+				matchStyle = GetColor("search-match.current")
+			}
+			for i := range styles {
+				if i < len(matched) && matched[i] {
+					styles[i] = matchStyle
+				}
+			}
+		}
+		if !softwrap {
+			c.lines = append(c.lines, c.layout(lineStr, styles, matched, buf, left, width, lineN, viewLine))
+			c.rows = append(c.rows, lineN)
+			viewLine++
+		} else {
+			// Each line shows the next width columns of the row
+			for wrapLeft := 0; viewLine < height; wrapLeft += width {
+				c.lines = append(c.lines, c.layout(lineStr, styles, matched, buf, wrapLeft, width, lineN, viewLine))
+				c.rows = append(c.rows, lineN)
+				viewLine++
+				if width == 0 || wrapLeft+width >= StringWidth(lineStr, 0) {
+					break
+				}
+			}
+		}
+
+		// newline
+		lineN++
+	}
+}
 
-		colN, startOffset, _ := visualToCharPos(left, lineN, lineStr, buf, 0)
-		if colN < 0 {
-			colN = len(line)
+// layout returns the characters of a row of text that are visible when
+// the view is scrolled left columns to the right
+func (c *CellView) layout(lineStr string, styles []tcell.Style, matched []bool, buf *Buffer, left, width, lineN, viewLine int) []*Char {
+	line := []rune(lineStr)
+
+	colN, startOffset, _ := visualToCharPos(left, lineN, lineStr, buf, 0)
+	if colN < 0 {
+		colN = len(line)
+	}
+	viewCol := -startOffset
+
+	// We'll either draw the length of the line, or the width of the screen
+	// whichever is smaller
+	lineLength := min(StringWidth(lineStr, 0), width)
+	chars := make([]*Char, lineLength)
+
+	for viewCol < lineLength {
+		if colN >= len(line) {
+			break
 		}
-		viewCol := -startOffset
 
-		// We'll either draw the length of the line, or the width of the screen
-		// whichever is smaller
-		lineLength := min(StringWidth(lineStr, 0), width)
-		c.lines = append(c.lines, make([]*Char, lineLength))
+		curStyle := defStyle
+		if colN < len(styles) {
+			curStyle = styles[colN]
+		}
 
-		for viewCol < lineLength {
-			if colN >= len(line) {
-				break
-			}
+		char := line[colN]
 
-			curStyle := defStyle
-			if viewCol > 26 && viewCol < 33 {
-				if lineObj.entry.level == "info" {
-					curStyle = StringToStyle("yellow")
-				} else if lineObj.entry.level == "error" {
-					curStyle = StringToStyle("red")
-				}
-			}
+		isMatch := colN < len(matched) && matched[colN]
 
-			char := line[colN]
+		if viewCol >= 0 {
+			chars[viewCol] = &Char{Loc{viewCol, viewLine}, Loc{colN, lineN}, char, char, curStyle, 1, isMatch}
+		}
 
+		if runewidth.RuneWidth(char) > 1 {
+			charWidth := runewidth.RuneWidth(char)
 			if viewCol >= 0 {
-				c.lines[viewLine][viewCol] = &Char{Loc{viewCol, viewLine}, Loc{colN, lineN}, char, char, curStyle, 1}
+				chars[viewCol].width = charWidth
 			}
-
-			if runewidth.RuneWidth(char) > 1 {
-				charWidth := runewidth.RuneWidth(char)
-				if viewCol >= 0 {
-					c.lines[viewLine][viewCol].width = charWidth
-				}
-				for i := 1; i < charWidth; i++ {
-					viewCol++
-					if viewCol >= 0 && viewCol < lineLength {
-						c.lines[viewLine][viewCol] = &Char{Loc{viewCol, viewLine}, Loc{colN, lineN}, char, ' ', curStyle, 1}
-					}
-				}
-				viewCol++
-			} else {
+			for i := 1; i < charWidth; i++ {
 				viewCol++
+				if viewCol >= 0 && viewCol < lineLength {
+					chars[viewCol] = &Char{Loc{viewCol, viewLine}, Loc{colN, lineN}, char, ' ', curStyle, 1, isMatch}
+				}
 			}
-			colN++
+			viewCol++
+		} else {
+			viewCol++
 		}
-
-		// newline
-		viewLine++
-		lineN++
+		colN++
 	}
+	return chars
 }
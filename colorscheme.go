@@ -1,21 +1,196 @@
 package main
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/zyedidia/tcell"
 )
 
+// Colorscheme is a map from string to style -- it represents a colorscheme
+type Colorscheme map[string]tcell.Style
+
+// The current colorscheme
+var colorscheme Colorscheme
+
+// The name of the current colorscheme
+var colorschemeName string
+
+// GetColor returns the style of a group. A group such as level.error that
+// isn't in the colorscheme falls back to its parent, level, and then to the
+// default style
+func GetColor(group string) tcell.Style {
+	for {
+		if style, ok := colorscheme[group]; ok {
+			return style
+		}
+		i := strings.LastIndex(group, ".")
+		if i < 0 {
+			return defStyle
+		}
+		group = group[:i]
+	}
+}
+
+// InitColorscheme loads the colorscheme given on the command line, or the
+// default one
+func InitColorscheme() {
+	colorscheme = make(Colorscheme)
+	defStyle = tcell.StyleDefault.
+		Foreground(tcell.ColorDefault).
+		Background(tcell.ColorDefault)
+
+	name := GetOption("colorscheme").(string)
+	if err := LoadColorscheme(name); err != nil {
+		TermMessage(err.Error())
+		LoadColorscheme("default")
+	}
+}
+
+// colorschemeFile returns the path of a colorscheme in the config directory
+func colorschemeFile(name string) string {
+	return filepath.Join(configDir, "colorschemes", name+".jv")
+}
+
+// ColorschemeExists checks if a given colorscheme exists
+func ColorschemeExists(name string) bool {
+	if _, ok := builtinColorschemes[name]; ok {
+		return true
+	}
+	_, err := os.Stat(colorschemeFile(name))
+	return err == nil
+}
+
+// ColorschemeNames returns the names of the built-in colorschemes and of
+// the ones in the config directory
+func ColorschemeNames() []string {
+	var names []string
+	for name := range builtinColorschemes {
+		names = append(names, name)
+	}
+	files, _ := ioutil.ReadDir(filepath.Join(configDir, "colorschemes"))
+	for _, f := range files {
+		if name := strings.TrimSuffix(f.Name(), ".jv"); name != f.Name() {
+			if _, ok := builtinColorschemes[name]; !ok {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadColorscheme makes the given colorscheme the current one. A file in
+// the colorschemes directory of the config directory takes precedence over
+// a built-in colorscheme of the same name. The groups a colorscheme leaves
+// out keep their style from the default colorscheme
+func LoadColorscheme(name string) error {
+	var text string
+	if data, err := ioutil.ReadFile(colorschemeFile(name)); err == nil {
+		text = string(data)
+	} else if builtin, ok := builtinColorschemes[name]; ok {
+		text = builtin
+	} else {
+		return errors.New(name + " is not a valid colorscheme")
+	}
+
+	links, err := parseColorLinks(text)
+	if err != nil {
+		return errors.New("Error loading colorscheme " + name + ": " + err.Error())
+	}
+
+	// Default style
+	oldStyle := defStyle
+	defStyle = tcell.StyleDefault.Foreground(tcell.ColorDefault).Background(tcell.ColorDefault)
+	c, err := ParseColorscheme(links)
+	if err != nil {
+		defStyle = oldStyle
+		return errors.New("Error loading colorscheme " + name + ": " + err.Error())
+	}
+	if name != "default" {
+		baseLinks, _ := parseColorLinks(builtinColorschemes["default"])
+		base, _ := ParseColorscheme(baseLinks)
+		for group, style := range base {
+			if _, ok := c[group]; !ok {
+				c[group] = style
+			}
+		}
+	}
+
+	colorscheme = c
+	colorschemeName = name
+	if screen != nil {
+		screen.SetStyle(defStyle)
+	}
+	return nil
+}
+
+// A colorLink is a color-link statement of a colorscheme
+type colorLink struct {
+	group, colors string
+}
+
+// parseColorLinks reads the color-link statements of a colorscheme
+func parseColorLinks(text string) ([]colorLink, error) {
+	parser := regexp.MustCompile(`^color-link\s+(\S*)\s+"(.*)"$`)
+	var links []colorLink
+	for lineNum, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			// Ignore this line
+			continue
+		}
+		matches := parser.FindStringSubmatch(line)
+		if len(matches) != 3 {
+			return nil, errors.New("line " + strconv.Itoa(lineNum+1) + ": color-link statement is not understood: " + line)
+		}
+		links = append(links, colorLink{matches[1], matches[2]})
+	}
+	return links, nil
+}
+
+// ParseColorscheme returns the colorscheme made of the given links.
+// Colorschemes are made up of color-link statements linking a color group
+// to a list of colors. For example, color-link level.error "bold red"
+// makes error levels bold and red. The default group sets the default
+// style, which the other groups take their missing colors from
+func ParseColorscheme(links []colorLink) (Colorscheme, error) {
+	c := make(Colorscheme)
+	for _, link := range links {
+		if link.group == "default" {
+			style, err := StringToStyle(link.colors)
+			if err != nil {
+				return nil, errors.New("default: " + err.Error())
+			}
+			defStyle = style
+		}
+	}
+	for _, link := range links {
+		style, err := StringToStyle(link.colors)
+		if err != nil {
+			return nil, errors.New(link.group + ": " + err.Error())
+		}
+		c[link.group] = style
+	}
+	return c, nil
+}
+
 // StringToStyle returns a style from a string
 // The strings must be in the format "extra foregroundcolor,backgroundcolor"
-// The 'extra' can be bold, reverse, or underline
-func StringToStyle(str string) tcell.Style {
+// The 'extra' can be bold, reverse, or underline, or several of them
+// separated by spaces
+func StringToStyle(str string) (tcell.Style, error) {
 	var fg, bg string
 	spaceSplit := strings.Split(str, " ")
 	var split []string
 	if len(spaceSplit) > 1 {
-		split = strings.Split(spaceSplit[1], ",")
+		split = strings.Split(spaceSplit[len(spaceSplit)-1], ",")
 	} else {
 		split = strings.Split(str, ",")
 	}
@@ -28,15 +203,16 @@ func StringToStyle(str string) tcell.Style {
 	bg = strings.TrimSpace(bg)
 
 	var fgColor, bgColor tcell.Color
+	var err error
 	if fg == "" {
 		fgColor, _, _ = defStyle.Decompose()
-	} else {
-		fgColor = StringToColor(fg)
+	} else if fgColor, err = StringToColor(fg); err != nil {
+		return defStyle, err
 	}
 	if bg == "" {
 		_, bgColor, _ = defStyle.Decompose()
-	} else {
-		bgColor = StringToColor(bg)
+	} else if bgColor, err = StringToColor(bg); err != nil {
+		return defStyle, err
 	}
 
 	style := defStyle.Foreground(fgColor).Background(bgColor)
@@ -49,59 +225,62 @@ func StringToStyle(str string) tcell.Style {
 	if strings.Contains(str, "underline") {
 		style = style.Underline(true)
 	}
-	return style
+	return style, nil
 }
 
 // StringToColor returns a tcell color from a string representation of a color
 // We accept either bright... or light... to mean the brighter version of a color
-func StringToColor(str string) tcell.Color {
+func StringToColor(str string) (tcell.Color, error) {
 	switch str {
 	case "black":
-		return tcell.ColorBlack
+		return tcell.ColorBlack, nil
 	case "red":
-		return tcell.ColorMaroon
+		return tcell.ColorMaroon, nil
 	case "green":
-		return tcell.ColorGreen
+		return tcell.ColorGreen, nil
 	case "yellow":
-		return tcell.ColorOlive
+		return tcell.ColorOlive, nil
 	case "blue":
-		return tcell.ColorNavy
+		return tcell.ColorNavy, nil
 	case "magenta":
-		return tcell.ColorPurple
+		return tcell.ColorPurple, nil
 	case "cyan":
-		return tcell.ColorTeal
+		return tcell.ColorTeal, nil
 	case "white":
-		return tcell.ColorSilver
+		return tcell.ColorSilver, nil
 	case "brightblack", "lightblack":
-		return tcell.ColorGray
+		return tcell.ColorGray, nil
 	case "brightred", "lightred":
-		return tcell.ColorRed
+		return tcell.ColorRed, nil
 	case "brightgreen", "lightgreen":
-		return tcell.ColorLime
+		return tcell.ColorLime, nil
 	case "brightyellow", "lightyellow":
-		return tcell.ColorYellow
+		return tcell.ColorYellow, nil
 	case "brightblue", "lightblue":
-		return tcell.ColorBlue
+		return tcell.ColorBlue, nil
 	case "brightmagenta", "lightmagenta":
-		return tcell.ColorFuchsia
+		return tcell.ColorFuchsia, nil
 	case "brightcyan", "lightcyan":
-		return tcell.ColorAqua
+		return tcell.ColorAqua, nil
 	case "brightwhite", "lightwhite":
-		return tcell.ColorWhite
+		return tcell.ColorWhite, nil
 	case "default":
-		return tcell.ColorDefault
+		return tcell.ColorDefault, nil
 	default:
 		// Check if this is a 256 color
 		if num, err := strconv.Atoi(str); err == nil {
 			return GetColor256(num)
 		}
 		// Probably a truecolor hex value
-		return tcell.GetColor(str)
+		return tcell.GetColor(str), nil
 	}
 }
 
 // GetColor256 returns the tcell color for a number between 0 and 255
-func GetColor256(color int) tcell.Color {
+func GetColor256(color int) (tcell.Color, error) {
+	if color < 0 || color > 255 {
+		return tcell.ColorDefault, errors.New("color " + strconv.Itoa(color) + " is not between 0 and 255")
+	}
 	colors := []tcell.Color{tcell.ColorBlack, tcell.ColorMaroon, tcell.ColorGreen,
 		tcell.ColorOlive, tcell.ColorNavy, tcell.ColorPurple,
 		tcell.ColorTeal, tcell.ColorSilver, tcell.ColorGray,
@@ -140,5 +319,5 @@ func GetColor256(color int) tcell.Color {
 		tcell.Color253, tcell.Color254, tcell.Color255,
 	}
 
-	return colors[color]
+	return colors[color], nil
 }
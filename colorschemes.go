@@ -0,0 +1,163 @@
+package main
+
+// The colorschemes built into jv. The groups are
+//
+//	default                the text and background of everything else
+//	statusline             the line with the file name below each view
+//	tabbar                 the list of tabs at the top of the screen when
+//	                       there are several, tabbar.current for the tab
+//	                       that is shown
+//	selection              the selected row
+//	gutter                 the line numbers
+//	header                 the column header, header.selected for the
+//	                       selected column
+//	column                 the cells of the columns, column.<title> for the
+//	                       cells of a single column
+//	level.<level>          the levels, from level.trace to level.fatal
+//	json-key, json-string, json-number, json-literal
+//	                       the entry in the detail pane
+//	detail-message         the message at the top of the detail pane
+//	unparsed               the header of lines that are not log entries
+//	divider                the line between a view and a detail pane
+//	search-match           the text matching the search, search-match.current
+//	                       for the matches on the selected row
+//	source.1 to source.6   the names of the files in the source column when
+//	                       several files are merged, they are taken in turn
+//	message, error-message the messages at the bottom of the screen
+var builtinColorschemes = map[string]string{
+	"default": `
+color-link statusline "reverse default"
+color-link tabbar "reverse default"
+color-link tabbar.current "bold default"
+color-link selection "reverse default"
+color-link gutter "default"
+color-link header "bold underline default"
+color-link header.selected "bold reverse default"
+color-link column "default"
+color-link level.trace "blue"
+color-link level.debug "cyan"
+color-link level.info "yellow"
+color-link level.warn "magenta"
+color-link level.error "red"
+color-link level.fatal "bold red"
+color-link json-key "blue"
+color-link json-string "green"
+color-link json-number "cyan"
+color-link json-literal "magenta"
+color-link detail-message "bold default"
+color-link unparsed "red"
+color-link divider "default"
+color-link search-match "black,yellow"
+color-link search-match.current "black,green"
+color-link source.1 "cyan"
+color-link source.2 "green"
+color-link source.3 "magenta"
+color-link source.4 "blue"
+color-link source.5 "yellow"
+color-link source.6 "red"
+color-link message "default"
+color-link error-message "black,red"
+`,
+
+	"simple": `
+color-link statusline "reverse default"
+color-link tabbar "reverse default"
+color-link tabbar.current "bold underline default"
+color-link selection "reverse default"
+color-link gutter "default"
+color-link header "bold underline default"
+color-link header.selected "bold reverse default"
+color-link column "default"
+color-link level "default"
+color-link level.warn "bold default"
+color-link level.error "bold underline default"
+color-link level.fatal "bold reverse default"
+color-link json-key "bold default"
+color-link json-string "default"
+color-link json-number "default"
+color-link json-literal "default"
+color-link detail-message "bold default"
+color-link unparsed "underline default"
+color-link divider "default"
+color-link search-match "underline default"
+color-link search-match.current "bold underline default"
+color-link source.1 "default"
+color-link source.2 "bold default"
+color-link source.3 "underline default"
+color-link source.4 "bold reverse default"
+color-link source.5 "bold underline default"
+color-link source.6 "reverse default"
+color-link message "default"
+color-link error-message "reverse default"
+`,
+
+	"solarized": `
+color-link default "244,234"
+color-link statusline "234,246"
+color-link tabbar "234,246"
+color-link tabbar.current "bold 234,33"
+color-link selection "230,240"
+color-link gutter "240,235"
+color-link header "bold 245,235"
+color-link header.selected "bold 234,33"
+color-link column "244"
+color-link level.trace "240"
+color-link level.debug "37"
+color-link level.info "33"
+color-link level.warn "136"
+color-link level.error "160"
+color-link level.fatal "bold 125"
+color-link json-key "33"
+color-link json-string "64"
+color-link json-number "37"
+color-link json-literal "61"
+color-link detail-message "bold 245"
+color-link unparsed "166"
+color-link divider "240"
+color-link search-match "234,136"
+color-link search-match.current "234,166"
+color-link source.1 "37"
+color-link source.2 "64"
+color-link source.3 "61"
+color-link source.4 "33"
+color-link source.5 "136"
+color-link source.6 "125"
+color-link message "244"
+color-link error-message "230,160"
+`,
+
+	"monokai": `
+color-link default "#F8F8F2,#272822"
+color-link statusline "#272822,#F8F8F2"
+color-link tabbar "#272822,#F8F8F2"
+color-link tabbar.current "bold #272822,#A6E22E"
+color-link selection "#F8F8F2,#49483E"
+color-link gutter "#90908A,#2D2E27"
+color-link header "bold #F8F8F2,#3E3D32"
+color-link header.selected "bold #272822,#A6E22E"
+color-link column "#F8F8F2"
+color-link level.trace "#75715E"
+color-link level.debug "#66D9EF"
+color-link level.info "#A6E22E"
+color-link level.warn "#E6DB74"
+color-link level.error "#F92672"
+color-link level.fatal "bold #F92672"
+color-link json-key "#66D9EF"
+color-link json-string "#E6DB74"
+color-link json-number "#AE81FF"
+color-link json-literal "#AE81FF"
+color-link detail-message "bold #F8F8F2"
+color-link unparsed "#FD971F"
+color-link divider "#75715E"
+color-link search-match "#272822,#E6DB74"
+color-link search-match.current "#272822,#FD971F"
+color-link source.1 "#66D9EF"
+color-link source.2 "#A6E22E"
+color-link source.3 "#AE81FF"
+color-link source.4 "#FD971F"
+color-link source.5 "#E6DB74"
+color-link source.6 "#F92672"
+color-link message "#F8F8F2"
+color-link error-message "#F8F8F2,#F92672"
+`,
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/flynn/json5"
+	"github.com/mattn/go-runewidth"
+	"github.com/zyedidia/tcell"
+)
+
+// A Column is one of the columns of the list view. It shows the value at a
+// JSON path of each entry, timestamp, level and message standing for the
+// mapped fields as in queries
+type Column struct {
+	// The title in the header, the path is used if it is empty
+	Name string `json:"name,omitempty"`
+	Path string `json:"path"`
+	// How many cells the column takes, 0 lets it take the rest of the line
+	Width int `json:"width,omitempty"`
+	// "left" or "right"
+	Align string `json:"align,omitempty"`
+	// Which end of a value wider than the column is cut: "end" or "start"
+	Truncate string `json:"truncate,omitempty"`
+	// How the value is displayed: "time", "delta" (the time since the line
+	// above), "level", "firstline", "duration" (of a number of
+	// milliseconds), "bytes", or as it is if empty
+	Format string `json:"format,omitempty"`
+}
+
+// The columns of the list view, from left to right
+var columns []*Column
+
+// The column the column actions apply to
+var selectedColumn int
+
+// What is put between two columns
+const columnSep = "  "
+
+var columnFormats = []string{"", "time", "delta", "level", "firstline", "duration", "bytes"}
+
+// DefaultColumns returns the timestamp, level and message columns
+func DefaultColumns() []*Column {
+	return []*Column{
+		{Path: "timestamp", Width: 24, Format: "time"},
+		{Path: "level", Width: 5, Format: "level"},
+		{Path: "message", Format: "firstline"},
+	}
+}
+
+// deltaColumn returns a column showing the time since the line above
+func deltaColumn() *Column {
+	return &Column{Name: "delta", Path: "timestamp", Width: 10, Align: "right", Format: "delta"}
+}
+
+// hasDeltaColumn returns whether one of the columns shows deltas
+func hasDeltaColumn() bool {
+	for _, c := range columns {
+		if c.Format == "delta" {
+			return true
+		}
+	}
+	return false
+}
+
+// toggleDeltaColumn removes the delta columns, or adds one after the first
+// time column if there are none
+func toggleDeltaColumn() {
+	var kept []*Column
+	for _, c := range columns {
+		if c.Format != "delta" {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) < len(columns) {
+		columns = kept
+		if selectedColumn >= len(columns) {
+			selectedColumn = len(columns) - 1
+		}
+		return
+	}
+
+	i := 0
+	for j, c := range columns {
+		if c.Format == "time" {
+			i = j + 1
+			break
+		}
+	}
+	columns = append(columns[:i], append([]*Column{deltaColumn()}, columns[i:]...)...)
+}
+
+// InitColumns reads the columns from columns.json in the config directory
+func InitColumns() {
+	columns = DefaultColumns()
+
+	filename := filepath.Join(configDir, "columns.json")
+	if _, e := os.Stat(filename); e == nil {
+		input, err := ioutil.ReadFile(filename)
+		if err != nil {
+			TermMessage("Error reading columns.json file: " + err.Error())
+			return
+		}
+
+		var parsed []*Column
+		if err := json5.Unmarshal(input, &parsed); err != nil {
+			TermMessage("Error reading columns.json:", err.Error())
+			return
+		}
+		for i, c := range parsed {
+			if err := c.Validate(); err != nil {
+				TermMessage("Error in column", i+1, "of columns.json:", err.Error())
+				return
+			}
+		}
+		if len(parsed) > 0 {
+			columns = parsed
+		}
+	}
+}
+
+// SaveColumns writes the columns to columns.json in the config directory
+func SaveColumns() error {
+	data, err := json.MarshalIndent(columns, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(configDir, os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(configDir, "columns.json"), append(data, '\n'), 0644)
+}
+
+// Validate checks that the options of a column have known values
+func (c *Column) Validate() error {
+	if c.Path == "" {
+		return errors.New("a column needs a path")
+	}
+	if c.Width < 0 {
+		return errors.New("the width of " + c.Path + " is negative")
+	}
+	if c.Align != "" && c.Align != "left" && c.Align != "right" {
+		return errors.New("unknown alignment " + strconv.Quote(c.Align))
+	}
+	if c.Truncate != "" && c.Truncate != "end" && c.Truncate != "start" {
+		return errors.New("unknown truncation " + strconv.Quote(c.Truncate))
+	}
+	for _, f := range columnFormats {
+		if c.Format == f {
+			return nil
+		}
+	}
+	return errors.New("unknown format " + strconv.Quote(c.Format))
+}
+
+// Title returns the text of the column in the header
+func (c *Column) Title() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Path
+}
+
+// Time returns the time in the column's field of a line
+func (c *Column) Time(line *Line) (time.Time, bool) {
+	if c.Path == "timestamp" {
+		return line.Time()
+	}
+	v, ok := fieldValue(line, c.Path)
+	if !ok {
+		return time.Time{}, false
+	}
+	return parseTimeValue(v, timestampLayouts)
+}
+
+// Cell returns the text of the column for a line and its style. prev is the
+// line displayed above, which deltas are taken from, and may be nil
+func (c *Column) Cell(line, prev *Line) (string, tcell.Style) {
+	text := c.Text(line, prev, GetOption("time").(string))
+	if c.Format == "level" {
+		if l := c.Level(line); l != LevelUnknown {
+			return text, levelStyle(l)
+		}
+	}
+	if c.Path == "source" && line.source != nil {
+		return text, line.source.Style()
+	}
+	return text, GetColor("column." + c.Title())
+}
+
+// Text returns the text of the cell of the column for a line, with times
+// shown in a display mode of the time option
+func (c *Column) Text(line, prev *Line, timeMode string) string {
+	v, ok := fieldValue(line, c.Path)
+
+	switch c.Format {
+	case "time":
+		if t, ok := c.Time(line); ok {
+			return formatTime(t, timeMode)
+		}
+	case "delta":
+		if prev == nil {
+			return ""
+		}
+		t, ok := c.Time(line)
+		pt, pok := c.Time(prev)
+		if !ok || !pok {
+			return ""
+		}
+		return formatDelta(t.Sub(pt))
+	case "level":
+		if l := c.Level(line); l != LevelUnknown {
+			return l.String()
+		}
+	case "firstline":
+		return strings.TrimSpace(strings.Split(valueToString(v), "\n")[0])
+	case "duration":
+		if f, ok := toFloat(v); ok {
+			return formatDuration(time.Duration(f * float64(time.Millisecond)))
+		}
+	case "bytes":
+		if f, ok := toFloat(v); ok {
+			return formatBytes(f)
+		}
+	}
+
+	if !ok {
+		return ""
+	}
+	return strings.Replace(valueToString(v), "\n", " ", -1)
+}
+
+// Level returns the level of the line in a level column
+func (c *Column) Level(line *Line) Level {
+	if c.Path == "level" {
+		return line.entry.severity
+	}
+	v, _ := fieldValue(line, c.Path)
+	return ParseLevel(v)
+}
+
+// Fit pads or cuts text to the width of the column
+func (c *Column) Fit(text string) string {
+	if c.Width == 0 {
+		return text
+	}
+	w := runewidth.StringWidth(text)
+	if w > c.Width {
+		if c.Truncate == "start" {
+			runes := []rune(text)
+			for w > c.Width-1 {
+				w -= runewidth.RuneWidth(runes[0])
+				runes = runes[1:]
+			}
+			return "…" + string(runes)
+		}
+		return runewidth.Truncate(text, c.Width, "…")
+	}
+	if c.Align == "right" {
+		return strings.Repeat(" ", c.Width-w) + text
+	}
+	return text + strings.Repeat(" ", c.Width-w)
+}
+
+// formatDuration returns a duration rounded to a readable precision
+func formatDuration(d time.Duration) string {
+	if d >= time.Second || d <= -time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Microsecond).String()
+}
+
+// formatBytes returns a size with a binary unit, such as 1.5M
+func formatBytes(f float64) string {
+	units := []string{"", "K", "M", "G", "T", "P"}
+	i := 0
+	for ; i < len(units)-1 && (f >= 1024 || f <= -1024); i++ {
+		f /= 1024
+	}
+	if i == 0 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64) + units[i]
+}
+
+// formatLine returns the text displayed for a line with the columns given
+// along with the style of each of its runes. prev is the line displayed
+// above it and may be nil
+func formatLine(cols []*Column, line, prev *Line) (string, []tcell.Style) {
+	if line.status != ParseOK {
+		// Show the raw text of anything that isn't a log entry, in line
+		// with the source column when files are merged
+		str := " "
+		styles := []tcell.Style{defStyle}
+		for _, c := range cols {
+			if c.Path == "source" && line.source != nil {
+				name := c.Fit(line.source.Name)
+				str += name + columnSep
+				styles = fillStyles(styles, line.source.Style(), name)
+				styles = fillStyles(styles, defStyle, columnSep)
+				break
+			}
+		}
+		raw := strings.TrimSpace(string(line.data))
+		return str + raw, fillStyles(styles, defStyle, raw)
+	}
+
+	str := " "
+	styles := []tcell.Style{defStyle}
+	for i, c := range cols {
+		if i > 0 {
+			str += columnSep
+			styles = fillStyles(styles, defStyle, columnSep)
+		}
+		text, style := c.Cell(line, prev)
+		text = c.Fit(text)
+		str += text
+		styles = fillStyles(styles, style, text)
+	}
+	return str, styles
+}
+
+// cellSpan returns the runes taken by the cell of column k in the text
+// formatLine gives for a log entry, from start up to end
+func cellSpan(cols []*Column, k int, line, prev *Line) (int, int) {
+	start := 1
+	for _, c := range cols[:k] {
+		text, _ := c.Cell(line, prev)
+		start += utf8.RuneCountInString(c.Fit(text) + columnSep)
+	}
+	text, _ := cols[k].Cell(line, prev)
+	return start, start + utf8.RuneCountInString(cols[k].Fit(text))
+}
+
+// formatHeader returns the header of the columns given along with the
+// style of each of its runes, the selected column is highlighted
+func formatHeader(cols []*Column) (string, []tcell.Style) {
+	headerStyle := GetColor("header")
+	var selected *Column
+	if selectedColumn >= 0 && selectedColumn < len(columns) {
+		selected = columns[selectedColumn]
+	}
+
+	str := " "
+	styles := []tcell.Style{headerStyle}
+	for i, c := range cols {
+		if i > 0 {
+			str += columnSep
+			styles = fillStyles(styles, headerStyle, columnSep)
+		}
+		style := headerStyle
+		if c == selected {
+			style = GetColor("header.selected")
+		}
+		text := c.Fit(c.Title())
+		str += text
+		styles = fillStyles(styles, style, text)
+	}
+	return str, styles
+}
+
+// fillStyles appends one style for each rune of str
+func fillStyles(styles []tcell.Style, style tcell.Style, str string) []tcell.Style {
+	for range str {
+		styles = append(styles, style)
+	}
+	return styles
+}
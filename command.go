@@ -1,8 +1,283 @@
 package main
 
-// Quit closes the main view
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A Command contains an action (a function to call) as well as information
+// about how to autocomplete the command
+type Command struct {
+	action      func([]string) bool
+	completions []Completion
+	// Whether the action is given the rest of the line as it was typed
+	raw bool
+}
+
+// A StrCommand is similar to a command but keeps the name of the action
+type StrCommand struct {
+	action      string
+	completions []Completion
+}
+
+var commands map[string]Command
+
+// The actions whose argument is a query or a time, which are given the
+// rest of the command line as it was typed instead of a list of arguments
+// so that quotes and backslashes reach their parser untouched
+var rawCommandActions = map[string]bool{
+	"Filter": true,
+	"Goto":   true,
+}
+
+var commandActions = map[string]func([]string) bool{
+	"Filter":         Filter,
+	"Goto":           Goto,
+	"Set":            Set,
+	"SetLocal":       SetLocal,
+	"Open":           Open,
+	"HSplit":         HSplit,
+	"VSplit":         VSplit,
+	"Export":         Export,
+	"Quit":           Quit,
+	"Colorscheme":    SetColorscheme,
+	"ReloadBindings": ReloadBindingsCmd,
+	"SaveColumns":    SaveColumnsCmd,
+	"ToggleSources":  ToggleSourcesCmd,
+}
+
+// InitCommands initializes the default commands
+func InitCommands() {
+	commands = make(map[string]Command)
+
+	defaults := DefaultCommands()
+	parseCommands(defaults)
+}
+
+func parseCommands(userCommands map[string]StrCommand) {
+	for k, v := range userCommands {
+		MakeCommand(k, v.action, v.completions...)
+	}
+}
+
+// MakeCommand is a function to easily create new commands
+func MakeCommand(name, function string, completions ...Completion) {
+	if action, ok := commandActions[function]; ok {
+		commands[name] = Command{action, completions, rawCommandActions[function]}
+	}
+}
+
+// DefaultCommands returns a map containing jv's default commands
+func DefaultCommands() map[string]StrCommand {
+	return map[string]StrCommand{
+		"filter":          {"Filter", []Completion{NoCompletion}},
+		"goto":            {"Goto", []Completion{NoCompletion}},
+		"set":             {"Set", []Completion{OptionCompletion, OptionValueCompletion}},
+		"setlocal":        {"SetLocal", []Completion{OptionCompletion, OptionValueCompletion}},
+		"open":            {"Open", []Completion{FileCompletion}},
+		"hsplit":          {"HSplit", []Completion{FileCompletion}},
+		"vsplit":          {"VSplit", []Completion{FileCompletion}},
+		"export":          {"Export", []Completion{FileCompletion}},
+		"quit":            {"Quit", []Completion{NoCompletion}},
+		"q":               {"Quit", []Completion{NoCompletion}},
+		"colorscheme":     {"Colorscheme", []Completion{ColorschemeCompletion}},
+		"reload-bindings": {"ReloadBindings", []Completion{NoCompletion}},
+		"save-columns":    {"SaveColumns", []Completion{NoCompletion}},
+		"source":          {"ToggleSources", []Completion{SourceCompletion}},
+	}
+}
+
+// HandleCommand handles input from the user
+func HandleCommand(input string) {
+	input = strings.TrimSpace(input)
+	args := SplitCommandArgs(input)
+	inputCmd := args[0]
+	if inputCmd == "" {
+		return
+	}
+
+	command, ok := commands[inputCmd]
+	if !ok {
+		messenger.Error("Unknown command ", inputCmd)
+		return
+	}
+	if command.raw {
+		args = nil
+		if i := strings.IndexAny(input, " \t"); i >= 0 {
+			args = []string{strings.TrimSpace(input[i:])}
+		}
+		command.action(args)
+		return
+	}
+	command.action(args[1:])
+}
+
+// Filter hides the lines that don't match the query given as argument,
+// without an argument it shows all the lines again
+func Filter(args []string) bool {
+	return CurView().ApplyFilter(strings.Join(args, " "))
+}
+
+// Goto moves the cursor to a line number or to a time
+func Goto(args []string) bool {
+	if len(args) == 0 {
+		messenger.Error("Usage: goto line|time")
+		return false
+	}
+	v := CurView()
+	if n, err := strconv.Atoi(args[0]); err == nil && len(args) == 1 {
+		return v.GotoLine(n)
+	}
+	if v.NumRows() == 0 {
+		return false
+	}
+	return v.GotoTime(strings.Join(args, " "))
+}
+
+// Set sets an option and saves it to settings.json
+func Set(args []string) bool {
+	if len(args) < 2 {
+		messenger.Error("Not enough arguments")
+		return false
+	}
+	return SetOptionAndSettings(args[0], args[1])
+}
+
+// SetLocal sets an option locally, for the buffer of the current view only
+func SetLocal(args []string) bool {
+	if len(args) < 2 {
+		messenger.Error("Not enough arguments")
+		return false
+	}
+	if err := SetLocalOption(args[0], args[1], CurView()); err != nil {
+		messenger.Error(err.Error())
+		return false
+	}
+	return true
+}
+
+// Open replaces the buffer of the current view with a file
+func Open(args []string) bool {
+	if len(args) < 1 {
+		messenger.Error("Usage: open filename...")
+		return false
+	}
+	return OpenTab(args)
+}
+
+// HSplit opens a file below the current view, or the same log again
+// without arguments
+func HSplit(args []string) bool {
+	v := CurView()
+	if len(args) == 0 {
+		v.HSplit(v.Buf)
+		return true
+	}
+	if buf := openFiles(args); buf != nil {
+		v.HSplit(buf)
+		return true
+	}
+	return false
+}
+
+// VSplit opens a file on the right of the current view, or the same log
+// again without arguments
+func VSplit(args []string) bool {
+	v := CurView()
+	if len(args) == 0 {
+		v.VSplit(v.Buf)
+		return true
+	}
+	if buf := openFiles(args); buf != nil {
+		v.VSplit(buf)
+		return true
+	}
+	return false
+}
+
+// Export writes the lines shown in the current view, with the filters
+// applied, to a file
+func Export(args []string) bool {
+	if len(args) != 1 {
+		messenger.Error("Usage: export filename")
+		return false
+	}
+	filename := ReplaceHome(args[0])
+	file, err := os.Create(filename)
+	if err != nil {
+		messenger.Error(err.Error())
+		return false
+	}
+
+	// The lines of an indexed file are read from it in chunks
+	snap := NewRowSnapshot(CurView().index)
+	w := bufio.NewWriter(file)
+	for _, c := range (rowRange{0, snap.Len(), false}).chunks() {
+		for _, line := range snap.Lines(c.start, c.end, false) {
+			w.Write(line.data)
+			w.WriteByte('\n')
+		}
+	}
+	err = w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		messenger.Error(err.Error())
+		return false
+	}
+	messenger.Message("Exported ", snap.Len(), " lines to ", filename)
+	return true
+}
+
+// ToggleSourcesCmd hides the lines of the merged files given, or shows them
+// again
+func ToggleSourcesCmd(args []string) bool {
+	if len(args) < 1 {
+		messenger.Error("Usage: source name...")
+		return false
+	}
+	return CurView().toggleSources(args)
+}
+
+// Quit closes the current tab, or exits if it is the last one
 func Quit(args []string) bool {
-	// Close the main view
 	CurView().Quit()
 	return false
 }
+
+// SetColorscheme switches to the colorscheme given as argument
+func SetColorscheme(args []string) bool {
+	if len(args) != 1 {
+		messenger.Error("Usage: colorscheme name")
+		return false
+	}
+	if err := LoadColorscheme(args[0]); err != nil {
+		messenger.Error(err)
+		return false
+	}
+	return true
+}
+
+// ReloadBindingsCmd reads bindings.json again
+func ReloadBindingsCmd(args []string) bool {
+	if errs := ReloadBindings(); len(errs) > 0 {
+		reportErrors(errs)
+		return false
+	}
+	messenger.Message("Reloaded bindings.json")
+	return true
+}
+
+// SaveColumnsCmd writes the current columns to columns.json, so that they
+// are used the next time jv starts
+func SaveColumnsCmd(args []string) bool {
+	if err := SaveColumns(); err != nil {
+		messenger.Error("Error saving columns: ", err)
+		return false
+	}
+	messenger.Message("Saved columns to columns.json")
+	return true
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// A Compression is a format that logs are commonly archived in, such as
+// the .gz files logrotate leaves behind
+type Compression struct {
+	Name string
+
+	// The first bytes of every file in this format
+	magic []byte
+	// valid checks the first 4 bytes further when the magic alone could
+	// start a plain text file, nil if the magic is enough
+	valid func(head []byte) bool
+	// open returns a reader for the decompressed contents of r
+	open func(r io.Reader) (io.Reader, error)
+	// size returns the decompressed size of a file from its header or
+	// trailer, or 0 if the format doesn't record it
+	size func(file *os.File, size int64) int64
+}
+
+var compressions = []*Compression{
+	{
+		Name:  "gzip",
+		magic: []byte{0x1f, 0x8b},
+		open: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		size: gzipSize,
+	},
+	{
+		Name:  "zstd",
+		magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		open: func(r io.Reader) (io.Reader, error) {
+			// With a single decoder the stream is decompressed as it is
+			// read, there are no goroutines left behind when we are done
+			return zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		},
+		size: zstdSize,
+	},
+	{
+		Name:  "bzip2",
+		magic: []byte("BZh"),
+		// The magic is followed by the block size, from 1 to 9
+		valid: func(head []byte) bool {
+			return len(head) > 3 && head[3] >= '1' && head[3] <= '9'
+		},
+		open: func(r io.Reader) (io.Reader, error) {
+			return bzip2.NewReader(r), nil
+		},
+	},
+}
+
+// Decompress detects the compression of r from its first bytes and returns
+// a reader for the decompressed contents. When r isn't compressed the
+// compression is nil and the reader gives r as it is
+func Decompress(r io.Reader) (io.Reader, *Compression, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(4)
+	for _, c := range compressions {
+		if bytes.HasPrefix(head, c.magic) && (c.valid == nil || c.valid(head)) {
+			dr, err := c.open(br)
+			if err != nil {
+				return nil, c, err
+			}
+			return &decompressReader{r: dr}, c, nil
+		}
+	}
+	return br, nil, nil
+}
+
+// DecompressedSize returns how large file will be once decompressed, or 0
+// if there is no telling
+func (c *Compression) DecompressedSize(file *os.File, size int64) int64 {
+	if c.size == nil {
+		return 0
+	}
+	return c.size(file, size)
+}
+
+// Logs rarely compress better than this, a gzip trailer or a zstd header
+// giving a larger size is more likely to be garbage from a truncated or
+// corrupt file
+const maxCompressionRatio = 64
+
+// gzipSize reads the size from the trailer of a gzip file. It is only
+// stored modulo 4GB and only for the last member of the file, so sizes
+// that can't be right are ignored
+func gzipSize(file *os.File, size int64) int64 {
+	var trailer [4]byte
+	if _, err := file.ReadAt(trailer[:], size-4); err != nil {
+		return 0
+	}
+	n := int64(binary.LittleEndian.Uint32(trailer[:]))
+	if n < size || n > size*maxCompressionRatio {
+		return 0
+	}
+	return n
+}
+
+// zstdSize reads the size from the header of the first frame of a zstd
+// file, it is only there if the compressor knew the size up front. Sizes
+// that can't be right are ignored, as for gzip
+func zstdSize(file *os.File, size int64) int64 {
+	header := make([]byte, zstd.HeaderMaxSize)
+	n, _ := file.ReadAt(header, 0)
+
+	var h zstd.Header
+	if err := h.Decode(header[:n]); err != nil || !h.HasFCS {
+		return 0
+	}
+	fcs := int64(h.FrameContentSize)
+	if fcs < size || fcs > size*maxCompressionRatio {
+		return 0
+	}
+	return fcs
+}
+
+// A decompressReader remembers the first error of a decompression. The
+// line array stops reading at an error without saying why, a truncated or
+// corrupt archive has to be reported once it has been read
+type decompressReader struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF && d.err == nil {
+		d.err = err
+	}
+	return n, err
+}
+
+// decompressErr returns the error that stopped the decompression of r, if
+// r was decompressed
+func decompressErr(r io.Reader) error {
+	if d, ok := r.(*decompressReader); ok {
+		return d.err
+	}
+	return nil
+}
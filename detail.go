@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/zyedidia/tcell"
+)
+
+// A detailChar is a character in the detail pane along with its style
+type detailChar struct {
+	r     rune
+	style tcell.Style
+}
+
+// A DetailPane shows the whole entry of the line selected in a view: the
+// full message followed by the entry as indented, highlighted JSON.
+// It takes its space from the view, either below the view's statusline or
+// to the right of the view
+type DetailPane struct {
+	view *View
+
+	// Whether the pane is to the right of the view instead of below it
+	vertical bool
+
+	// Where the pane is on the screen
+	x, y          int
+	width, height int
+
+	// The first row of the content that is shown, used for scrolling
+	topline int
+	// The buffer line the pane is showing
+	line int
+	// How many rows the content took the last time it was displayed
+	numRows int
+}
+
+// NewDetailPane opens a detail pane for a view, taking half of its space
+func NewDetailPane(v *View, vertical bool) *DetailPane {
+	p := &DetailPane{
+		view:     v,
+		vertical: vertical,
+		line:     -1,
+	}
+	p.Layout()
+	return p
+}
+
+// Layout takes half of the space of the view for the pane. The pane keeps
+// the line it shows and how far it is scrolled, when the view was resized
+// the scrolling is fixed on the next display
+func (p *DetailPane) Layout() {
+	v := p.view
+	if p.vertical {
+		p.width = v.Width / 2
+		v.Width -= p.width
+		p.x, p.y = v.x+v.Width, v.y
+		// The pane goes down next to the statusline as well
+		p.height = v.Height + v.statuslineRows()
+	} else {
+		p.height = (v.Height + v.statuslineRows()) / 2
+		v.Height -= p.height
+		p.x, p.y = v.x, v.y+v.Height+v.statuslineRows()
+		p.width = v.Width
+	}
+}
+
+// Close gives the space of the pane back to its view
+func (p *DetailPane) Close() {
+	if p.vertical {
+		p.view.Width += p.width
+	} else {
+		p.view.Height += p.height
+	}
+}
+
+// Scroll scrolls the content of the pane by n rows, up if n is negative
+func (p *DetailPane) Scroll(n int) {
+	p.topline += n
+	if p.topline > p.numRows-p.height {
+		p.topline = p.numRows - p.height
+	}
+	if p.topline < 0 {
+		p.topline = 0
+	}
+}
+
+// Display draws the entry of the view's current line
+func (p *DetailPane) Display() {
+	v := p.view
+	if bufLine := v.BufLine(v.Line); bufLine != p.line {
+		// A new line was selected, start again from the top
+		p.line = bufLine
+		p.topline = 0
+	}
+
+	x, width := p.x, p.width
+	if p.vertical {
+		for y := 0; y < p.height; y++ {
+			screen.SetContent(x, p.y+y, '│', nil, GetColor("divider"))
+		}
+		x++
+		width--
+	}
+
+	line := v.Buf.Line(p.line)
+	rows := wrapDetail(renderDetail(&line), width)
+	p.numRows = len(rows)
+	p.Scroll(0)
+
+	for y := 0; y < p.height; y++ {
+		screenX := 0
+		if p.topline+y < len(rows) {
+			for _, c := range rows[p.topline+y] {
+				screen.SetContent(x+screenX, p.y+y, c.r, nil, c.style)
+				screenX += runewidth.RuneWidth(c.r)
+			}
+		}
+		for ; screenX < width; screenX++ {
+			screen.SetContent(x+screenX, p.y+y, ' ', nil, defStyle)
+		}
+	}
+}
+
+// renderDetail returns the content of the pane for a line, one slice of
+// characters per line of text
+func renderDetail(line *Line) [][]detailChar {
+	var rows [][]detailChar
+
+	if line.status != ParseOK {
+		rows = append(rows, styledRow("Not parsed: "+line.status.String(), GetColor("unparsed")))
+		for _, l := range strings.Split(string(line.data), "\n") {
+			rows = append(rows, styledRow(l, defStyle))
+		}
+		return rows
+	}
+
+	if line.entry.message != "" {
+		for _, l := range strings.Split(line.entry.message, "\n") {
+			rows = append(rows, styledRow(l, GetColor("detail-message")))
+		}
+		rows = append(rows, nil)
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, line.data, "", "  "); err != nil {
+		return append(rows, styledRow(string(line.data), defStyle))
+	}
+	return append(rows, highlightJSON(pretty.String())...)
+}
+
+// styledRow returns a row made of str in a single style
+func styledRow(str string, style tcell.Style) []detailChar {
+	row := make([]detailChar, 0, len(str))
+	for _, r := range str {
+		if r == '\t' {
+			r = ' '
+		}
+		row = append(row, detailChar{r, style})
+	}
+	return row
+}
+
+// highlightJSON splits indented JSON into rows of characters coloured by
+// the kind of token they belong to
+func highlightJSON(text string) [][]detailChar {
+	keyStyle := GetColor("json-key")
+	stringStyle := GetColor("json-string")
+	numberStyle := GetColor("json-number")
+	literalStyle := GetColor("json-literal")
+
+	var rows [][]detailChar
+	var row []detailChar
+	add := func(runes []rune, style tcell.Style) {
+		for _, r := range runes {
+			row = append(row, detailChar{r, style})
+		}
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		j := i + 1
+		switch {
+		case r == '\n':
+			rows = append(rows, row)
+			row = nil
+			i++
+			continue
+		case r == '"':
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(runes) {
+				j++
+			}
+			// A string followed by a colon is a key
+			k := j
+			for k < len(runes) && runes[k] == ' ' {
+				k++
+			}
+			if k < len(runes) && runes[k] == ':' {
+				add(runes[i:j], keyStyle)
+			} else {
+				add(runes[i:j], stringStyle)
+			}
+		case r == '-' || unicode.IsDigit(r):
+			for j < len(runes) && strings.ContainsRune("+-.eE0123456789", runes[j]) {
+				j++
+			}
+			add(runes[i:j], numberStyle)
+		case unicode.IsLetter(r):
+			for j < len(runes) && unicode.IsLetter(runes[j]) {
+				j++
+			}
+			add(runes[i:j], literalStyle)
+		default:
+			add(runes[i:j], defStyle)
+		}
+		i = j
+	}
+	return append(rows, row)
+}
+
+// wrapDetail breaks rows which are wider than width into several rows
+func wrapDetail(rows [][]detailChar, width int) [][]detailChar {
+	if width <= 0 {
+		return nil
+	}
+	var wrapped [][]detailChar
+	for _, row := range rows {
+		start, w := 0, 0
+		for i, c := range row {
+			rw := runewidth.RuneWidth(c.r)
+			if w+rw > width {
+				wrapped = append(wrapped, row[start:i])
+				start, w = i, 0
+			}
+			w += rw
+		}
+		wrapped = append(wrapped, row[start:])
+	}
+	return wrapped
+}
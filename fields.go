@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flynn/json5"
+)
+
+// How many lines at the start of a file are used to detect its format
+const fieldDetectLines = 500
+
+// FieldMapping tells where the fields jv displays are found in a log entry.
+// Each field has a list of JSON paths which are tried in order, nested
+// objects are reached with dots as in "log.level". Timestamps are parsed
+// with the first of the layouts that works, in Go's reference time format
+type FieldMapping struct {
+	Timestamp []string `json:"timestamp"`
+	Level     []string `json:"level"`
+	Message   []string `json:"message"`
+
+	Layouts []string `json:"timestamp_layouts"`
+}
+
+// The field mapping from the defaults, the config file and the command line
+var fieldMapping *FieldMapping
+
+// The fields whose paths were set by the user and must not be reordered
+// by the format detection
+var fieldsConfigured = make(map[string]bool)
+
+// DefaultFieldMapping returns the paths used by the most common JSON
+// loggers: zap, logrus, bunyan, pino, GCP and the Elastic common schema
+func DefaultFieldMapping() *FieldMapping {
+	return &FieldMapping{
+		Timestamp: []string{"timestamp", "@timestamp", "time", "ts", "date", "datetime"},
+		Level:     []string{"level", "severity", "log.level", "lvl", "levelname", "loglevel"},
+		Message:   []string{"message", "msg", "textPayload", "jsonPayload.message", "@message", "log"},
+		Layouts:   timestampLayouts,
+	}
+}
+
+// InitFieldMapping reads the field mapping from fields.json in the config
+// directory and from the command line flags, which take precedence
+func InitFieldMapping() {
+	fieldMapping = DefaultFieldMapping()
+	var layouts []string
+
+	filename := configDir + "/fields.json"
+	if _, e := os.Stat(filename); e == nil {
+		input, err := ioutil.ReadFile(filename)
+		if err != nil {
+			TermMessage("Error reading fields.json file: " + err.Error())
+			return
+		}
+
+		var parsed FieldMapping
+		if err := json5.Unmarshal(input, &parsed); err != nil {
+			TermMessage("Error reading fields.json:", err.Error())
+			return
+		}
+		fieldMapping.set("timestamp", parsed.Timestamp)
+		fieldMapping.set("level", parsed.Level)
+		fieldMapping.set("message", parsed.Message)
+		layouts = parsed.Layouts
+	}
+
+	if *flagTimeLayout != "" {
+		layouts = append([]string{*flagTimeLayout}, layouts...)
+	}
+	if len(layouts) > 0 {
+		// The user's layouts are also used for the times typed in queries
+		// and prompts
+		timestampLayouts = append(layouts, timestampLayouts...)
+		fieldMapping.Layouts = timestampLayouts
+	}
+
+	fieldMapping.set("timestamp", splitPaths(*flagTimestampKey))
+	fieldMapping.set("level", splitPaths(*flagLevelKey))
+	fieldMapping.set("message", splitPaths(*flagMessageKey))
+}
+
+// splitPaths splits a comma separated list of paths given on the command line
+func splitPaths(str string) []string {
+	var paths []string
+	for _, p := range strings.Split(str, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// set replaces the paths of a field if any are given
+func (f *FieldMapping) set(field string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	*f.paths(field) = paths
+	fieldsConfigured[field] = true
+}
+
+// paths returns a pointer to the list of paths for a field
+func (f *FieldMapping) paths(field string) *[]string {
+	switch field {
+	case "timestamp":
+		return &f.Timestamp
+	case "level":
+		return &f.Level
+	default:
+		return &f.Message
+	}
+}
+
+// Detect returns a copy of the mapping where the paths of every field that
+// wasn't configured by the user are sorted by how many of the sample lines
+// contain them. This way a zap log uses "ts" and "msg" straight away even
+// if it also happens to have a "time" key somewhere. The timestamp layouts
+// are sorted the same way
+func (f *FieldMapping) Detect(sample []Line) *FieldMapping {
+	detected := *f
+	for _, field := range []string{"timestamp", "level", "message"} {
+		if fieldsConfigured[field] {
+			continue
+		}
+		paths := append([]string{}, *f.paths(field)...)
+		counts := make(map[string]int)
+		for _, line := range sample {
+			for _, p := range paths {
+				if _, ok := lookupPath(line.entry.data, p); ok {
+					counts[p]++
+				}
+			}
+		}
+		sort.SliceStable(paths, func(i, j int) bool {
+			return counts[paths[i]] > counts[paths[j]]
+		})
+		*detected.paths(field) = paths
+	}
+
+	var timestamps []string
+	for _, line := range sample {
+		if v, ok := lookup(line.entry.data, detected.Timestamp); ok {
+			if str, ok := v.(string); ok {
+				timestamps = append(timestamps, strings.TrimSpace(str))
+			}
+		}
+	}
+	detected.Layouts = rankLayouts(f.Layouts, timestamps)
+	return &detected
+}
+
+// lookup returns the value of the first of the paths present in data
+func lookup(data map[string]interface{}, paths []string) (interface{}, bool) {
+	for _, p := range paths {
+		if v, ok := lookupPath(data, p); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// lookupPath returns the value at a dotted path in data. A key which
+// contains dots itself, such as "log.level" in ECS logs, is matched first
+func lookupPath(data map[string]interface{}, path string) (interface{}, bool) {
+	if data == nil {
+		return nil, false
+	}
+	if v, ok := data[path]; ok {
+		return v, true
+	}
+
+	var cur interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// valueToString converts a JSON value to the text that is displayed for it
+func valueToString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
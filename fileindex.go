@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"os"
+)
+
+const (
+	// Files at least this large are indexed instead of being read into
+	// memory when they are opened
+	indexThreshold = 32 << 20
+	// How much of the file the indexer reads at a time, the offsets found
+	// in each block are handed to the UI in a single job
+	indexBlockSize = 4 << 20
+	// How many parsed lines of an indexed file are kept in memory
+	lineCacheSize = 4096
+)
+
+// A FileIndex gives the lines of a file without keeping them in memory.
+// The file is scanned for the offsets of its lines in the background, the
+// lines are read and parsed when they are needed and the most recently
+// used ones are kept in a cache.
+// The offsets are only appended to on the UI goroutine, the lines can be
+// read from any goroutine with the offsets of a snapshot
+type FileIndex struct {
+	file *os.File
+	// The size of the file when it was opened, the indexer stops there
+	size int64
+
+	// Where each line starts, a line ends before the newline that comes
+	// before the start of the next one
+	offsets []int64
+	// Where the last line ends
+	end int64
+	// How much of the file has been indexed
+	indexed int64
+	// Whether the whole file has been indexed
+	done bool
+
+	cache *lineCache
+
+	stop    chan bool
+	stopped bool
+}
+
+// NewFileIndex returns the index of a file, which is empty until Start is
+// called
+func NewFileIndex(file *os.File, size int64) *FileIndex {
+	return &FileIndex{
+		file:  file,
+		size:  size,
+		end:   size,
+		cache: newLineCache(lineCacheSize),
+		stop:  make(chan bool),
+	}
+}
+
+// Start scans the file for lines in the background. The offsets found are
+// given to add on the UI goroutine through the jobs channel, done is true
+// for the last call
+func (fi *FileIndex) Start(add func(offsets []int64, indexed int64, done bool)) {
+	go func() {
+		block := make([]byte, indexBlockSize)
+		offsets := []int64{0}
+		for pos := int64(0); pos < fi.size; {
+			select {
+			case <-fi.stop:
+				return
+			default:
+			}
+
+			n, err := fi.file.ReadAt(block[:Min(len(block), int(fi.size-pos))], pos)
+			for i := 0; i < n; {
+				j := bytes.IndexByte(block[i:n], '\n')
+				if j < 0 {
+					break
+				}
+				i += j + 1
+				offsets = append(offsets, pos+int64(i))
+			}
+			pos += int64(n)
+			if err != nil {
+				// The file shrank, what was read is all there is
+				break
+			}
+
+			found, indexed := offsets, pos
+			jobs <- JobFunction{func(output string, args ...string) {
+				add(found, indexed, false)
+			}, "", nil}
+			offsets = nil
+		}
+
+		// The last line goes up to the end of the file
+		jobs <- JobFunction{func(output string, args ...string) {
+			add(offsets, fi.size, true)
+		}, "", nil}
+	}()
+}
+
+// Stop stops the indexing and closes the file
+func (fi *FileIndex) Stop() {
+	if fi.stopped {
+		return
+	}
+	fi.stopped = true
+	close(fi.stop)
+	fi.file.Close()
+}
+
+// add appends offsets found by the indexer, it runs on the UI goroutine.
+// Offsets are only added once the line before them is complete, so the
+// last offset is where a line starts that is still being indexed
+func (fi *FileIndex) add(offsets []int64, indexed int64, done bool) {
+	fi.offsets = append(fi.offsets, offsets...)
+	fi.indexed = indexed
+	fi.done = done
+}
+
+// Len returns the number of complete lines that were indexed
+func (fi *FileIndex) Len() int {
+	if fi.done {
+		return len(fi.offsets)
+	}
+	return Max(len(fi.offsets)-1, 0)
+}
+
+// Progress returns how much of the file has been indexed, from 0 to 1
+func (fi *FileIndex) Progress() float64 {
+	if fi.size == 0 {
+		return 1
+	}
+	return float64(fi.indexed) / float64(fi.size)
+}
+
+// pop removes the last line from the index, it is kept in memory when data
+// is appended to it
+func (fi *FileIndex) pop() {
+	n := len(fi.offsets) - 1
+	fi.end = fi.offsets[n]
+	fi.offsets = fi.offsets[:n]
+	fi.cache.Remove(n)
+}
+
+// ReadLine reads line n without parsing it
+func (fi *FileIndex) ReadLine(n int) []byte {
+	return readLine(fi.file, fi.offsets, fi.end, n)
+}
+
+// Line returns line n parsed with fields, from the cache if it is there.
+// This is only used on the UI goroutine
+func (fi *FileIndex) Line(n int, fields *FieldMapping) Line {
+	if line, ok := fi.cache.Get(n); ok {
+		return line
+	}
+	line := NewLine(fi.ReadLine(n), fields)
+	fi.cache.Add(n, line)
+	return line
+}
+
+// readLine reads line n of a file from its offsets, lastEnd is where the
+// last line ends
+func readLine(file *os.File, offsets []int64, lastEnd int64, n int) []byte {
+	start, end := offsets[n], lastEnd
+	if n+1 < len(offsets) {
+		end = offsets[n+1]
+	}
+	data := make([]byte, end-start)
+	k, _ := file.ReadAt(data, start)
+	return trimNewline(data[:k])
+}
+
+// readLines reads the lines from first to last, included, with a single
+// read
+func readLines(file *os.File, offsets []int64, lastEnd int64, first, last int) [][]byte {
+	start, end := offsets[first], lastEnd
+	if last+1 < len(offsets) {
+		end = offsets[last+1]
+	}
+	data := make([]byte, end-start)
+	k, _ := file.ReadAt(data, start)
+	data = data[:k]
+
+	lines := make([][]byte, 0, last-first+1)
+	for n := first; n <= last; n++ {
+		lineEnd := int64(len(data))
+		if n+1 <= last {
+			lineEnd = Min64(offsets[n+1]-start, lineEnd)
+		}
+		lineStart := Min64(offsets[n]-start, lineEnd)
+		lines = append(lines, trimNewline(data[lineStart:lineEnd]))
+	}
+	return lines
+}
+
+// trimNewline removes the line ending at the end of data
+func trimNewline(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte{'\n'})
+	return bytes.TrimSuffix(data, []byte{'\r'})
+}
+
+// A lineCache keeps the most recently used parsed lines of an index
+type lineCache struct {
+	size  int
+	order *list.List
+	lines map[int]*list.Element
+}
+
+type cachedLine struct {
+	n    int
+	line Line
+}
+
+func newLineCache(size int) *lineCache {
+	return &lineCache{
+		size:  size,
+		order: list.New(),
+		lines: make(map[int]*list.Element),
+	}
+}
+
+// Get returns line n if it is in the cache
+func (c *lineCache) Get(n int) (Line, bool) {
+	if e, ok := c.lines[n]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*cachedLine).line, true
+	}
+	return Line{}, false
+}
+
+// Add puts line n in the cache, dropping the least recently used line if
+// the cache is full
+func (c *lineCache) Add(n int, line Line) {
+	if e, ok := c.lines[n]; ok {
+		e.Value.(*cachedLine).line = line
+		c.order.MoveToFront(e)
+		return
+	}
+	c.lines[n] = c.order.PushFront(&cachedLine{n, line})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.lines, oldest.Value.(*cachedLine).n)
+	}
+}
+
+// Remove removes line n from the cache
+func (c *lineCache) Remove(n int) {
+	if e, ok := c.lines[n]; ok {
+		c.order.Remove(e)
+		delete(c.lines, n)
+	}
+}
+
+// Clear empties the cache
+func (c *lineCache) Clear() {
+	c.order.Init()
+	c.lines = make(map[int]*list.Element)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// How often a followed file is checked for new data
+	followInterval = 250 * time.Millisecond
+	// The largest amount of data handed to the UI in a single job
+	followChunkSize = 1 << 20
+)
+
+// countingReader wraps a reader and counts how many bytes were read from it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// A Follower watches the file of a buffer and appends everything written to
+// it, like tail -f. When the file is truncated or replaced (log rotation)
+// the buffer is reloaded from the start of the new file.
+// The reading is done in the background and the new data is handed to the
+// main loop through the jobs channel so the buffer is only ever modified
+// on the UI goroutine
+type Follower struct {
+	buf  *Buffer
+	path string
+
+	file *os.File
+	// How far into the file we have read
+	offset int64
+
+	stop chan bool
+}
+
+// NewFollower returns a follower for buf which continues reading file
+// at offset
+func NewFollower(buf *Buffer, file *os.File, offset int64) *Follower {
+	return &Follower{
+		buf:    buf,
+		path:   buf.Path,
+		file:   file,
+		offset: offset,
+		stop:   make(chan bool),
+	}
+}
+
+// Start starts following the file in the background
+func (f *Follower) Start() {
+	go f.run()
+}
+
+// Stop stops following the file
+func (f *Follower) Stop() {
+	close(f.stop)
+}
+
+func (f *Follower) run() {
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			if f.file != nil {
+				f.file.Close()
+			}
+			return
+		case <-ticker.C:
+			f.poll()
+		}
+	}
+}
+
+// poll reads whatever was written since the last poll and checks if the
+// file was truncated or rotated
+func (f *Follower) poll() {
+	if f.file == nil {
+		// The file was gone at the last poll, it may be back by now
+		if f.reopen() {
+			f.readNew()
+		}
+		return
+	}
+
+	f.readNew()
+
+	info, err := f.file.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() < f.offset {
+		// The file was truncated in place
+		f.offset = 0
+		f.reset("truncated")
+		f.readNew()
+		return
+	}
+
+	pathInfo, err := os.Stat(f.path)
+	if err != nil || !os.SameFile(info, pathInfo) {
+		// The file was moved away or deleted. Everything that was left in
+		// it has been read above so we can switch to the new file
+		f.file.Close()
+		f.file = nil
+		if f.reopen() {
+			f.readNew()
+		}
+	}
+}
+
+// reopen opens the file at the followed path and reloads the buffer from it
+func (f *Follower) reopen() bool {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false
+	}
+	f.file = file
+	f.offset = 0
+	f.reset("replaced")
+	return true
+}
+
+// readNew hands everything after the current offset to the UI
+func (f *Follower) readNew() {
+	chunk := make([]byte, followChunkSize)
+	for {
+		n, err := f.file.ReadAt(chunk, f.offset)
+		if n > 0 {
+			f.offset += int64(n)
+			jobs <- JobFunction{f.appendJob, string(chunk[:n]), nil}
+		}
+		if err != nil || n < len(chunk) {
+			return
+		}
+	}
+}
+
+// reset tells the UI to empty the buffer, the reason is shown to the user
+func (f *Follower) reset(reason string) {
+	jobs <- JobFunction{f.resetJob, reason, nil}
+}
+
+// appendJob runs on the UI goroutine and adds the output to the buffer
+func (f *Follower) appendJob(output string, args ...string) {
+	appendAndPin(f.buf, []byte(output))
+}
+
+// resetJob runs on the UI goroutine and empties the buffer
+func (f *Follower) resetJob(output string, args ...string) {
+	f.buf.Reset()
+
+	for _, v := range allViews() {
+		if v.Buf == f.buf {
+			v.Line = 0
+			v.Topline = 0
+		}
+	}
+	messenger.Message(f.buf.GetName(), " was ", output, ", reloading")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/zyedidia/tcell"
+)
+
+// Level is the severity of a log entry. Levels are ordered, so a line is
+// at least as severe as warn if its level is >= LevelWarn
+type Level int
+
+const (
+	// LevelUnknown means the entry has no level or one we don't know
+	LevelUnknown Level = iota
+	LevelTrace
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = []string{"", "trace", "debug", "info", "warn", "error", "fatal"}
+
+// String returns the canonical name of the level
+func (l Level) String() string {
+	if l < LevelUnknown || int(l) >= len(levelNames) {
+		return ""
+	}
+	return levelNames[l]
+}
+
+// The spellings of the levels used by common loggers, syslog, GCP,
+// log4j and Python's logging, lowercased
+var levelSpellings = map[string]Level{
+	"trace":   LevelTrace,
+	"trc":     LevelTrace,
+	"t":       LevelTrace,
+	"verbose": LevelTrace,
+	"finest":  LevelTrace,
+	"finer":   LevelTrace,
+
+	"debug": LevelDebug,
+	"dbg":   LevelDebug,
+	"d":     LevelDebug,
+	"fine":  LevelDebug,
+
+	"info":          LevelInfo,
+	"inf":           LevelInfo,
+	"i":             LevelInfo,
+	"information":   LevelInfo,
+	"informational": LevelInfo,
+	"notice":        LevelInfo,
+	"config":        LevelInfo,
+
+	"warn":    LevelWarn,
+	"warning": LevelWarn,
+	"wrn":     LevelWarn,
+	"w":       LevelWarn,
+
+	"error":  LevelError,
+	"err":    LevelError,
+	"eror":   LevelError,
+	"e":      LevelError,
+	"severe": LevelError,
+
+	"fatal":     LevelFatal,
+	"ftl":       LevelFatal,
+	"f":         LevelFatal,
+	"critical":  LevelFatal,
+	"crit":      LevelFatal,
+	"alert":     LevelFatal,
+	"emergency": LevelFatal,
+	"emerg":     LevelFatal,
+	"panic":     LevelFatal,
+	"dpanic":    LevelFatal,
+}
+
+// ParseLevel returns the level of the value of a level field. Names are
+// matched without case, numbers 0 to 7 are syslog severities and numbers
+// from 10 up are Bunyan and pino levels (10 trace, 20 debug ... 60 fatal)
+func ParseLevel(v interface{}) Level {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return numericLevel(n)
+		}
+	case float64:
+		return numericLevel(int64(v))
+	case string:
+		str := strings.ToLower(strings.TrimSpace(v))
+		if l, ok := levelSpellings[str]; ok {
+			return l
+		}
+		if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return numericLevel(n)
+		}
+	}
+	return LevelUnknown
+}
+
+// numericLevel returns the level of a syslog or Bunyan numeric level
+func numericLevel(n int64) Level {
+	switch {
+	case n < 0:
+		return LevelUnknown
+	case n <= 2:
+		// emerg, alert, crit
+		return LevelFatal
+	case n == 3:
+		return LevelError
+	case n == 4:
+		return LevelWarn
+	case n <= 6:
+		// notice, info
+		return LevelInfo
+	case n == 7:
+		return LevelDebug
+	case n < 10:
+		return LevelUnknown
+	case n >= 60:
+		return LevelFatal
+	}
+	return LevelTrace + Level(n/10-1)
+}
+
+// ParseLevelInput parses a level typed by the user, such as "warn" or
+// "warn+". An empty string is LevelUnknown, which shows every level
+func ParseLevelInput(str string) (Level, bool) {
+	str = strings.TrimSuffix(strings.TrimSpace(str), "+")
+	if str == "" {
+		return LevelUnknown, true
+	}
+	l := ParseLevel(str)
+	return l, l != LevelUnknown
+}
+
+// levelStyle returns the style the level of a line is drawn with
+func levelStyle(l Level) tcell.Style {
+	if l == LevelUnknown {
+		return GetColor("column")
+	}
+	return GetColor("level." + l.String())
+}
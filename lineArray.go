@@ -2,8 +2,14 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/Jeffail/gabs"
@@ -36,48 +42,134 @@ type LogEntry struct {
 	level     string
 	message   string
 	data      map[string]interface{}
+
+	// The parsed timestamp, zero if there is none or it couldn't be parsed
+	time time.Time
+	// The level mapped onto the ordered severities
+	severity Level
+}
+
+// ParseStatus tells whether a line could be parsed as a log entry
+type ParseStatus int
+
+const (
+	// ParseOK means the line is a JSON object
+	ParseOK ParseStatus = iota
+	// ParseEmpty means the line is blank
+	ParseEmpty
+	// ParseInvalid means the line is not valid JSON
+	ParseInvalid
+	// ParseNotObject means the line is valid JSON but not an object
+	ParseNotObject
+)
+
+// String returns a description of the status for the parse summary
+func (s ParseStatus) String() string {
+	switch s {
+	case ParseOK:
+		return "parsed"
+	case ParseEmpty:
+		return "empty"
+	case ParseInvalid:
+		return "invalid JSON"
+	default:
+		return "not a JSON object"
+	}
 }
 
 // Line is a raw line
 type Line struct {
-	data  []byte
-	entry LogEntry
+	data   []byte
+	entry  LogEntry
+	status ParseStatus
+	// The file the line comes from when several files are merged
+	source *Source
 }
 
+// String returns the text displayed for the line in the list view
 func (line *Line) String() string {
-	firstLine := strings.Split(line.entry.message, "\n")[0]
-	spaces := PadRight("", " ", 2)
-	str := " "
-	str += PadRight(line.entry.timestamp, " ", 24)
-	str += spaces
-	str += PadRight(line.entry.level, " ", 5)
-	str += spaces
-	str += strings.TrimSpace(firstLine)
+	str, _ := formatLine(columns, line, nil)
 	return str
 }
 
-func NewLine(data []byte) Line {
-	// data := []byte(rawLine)
-	// ignore errors
-	parsedLine, err := gabs.ParseJSON(data)
+// Time returns the time of the entry if it has a timestamp that could
+// be parsed
+func (line *Line) Time() (time.Time, bool) {
+	return line.entry.time, !line.entry.time.IsZero()
+}
+
+// NewLine parses a raw line and fills its entry from the fields.
+// Lines that are not JSON objects keep an empty entry and a status
+// telling what is wrong with them
+func NewLine(data []byte, fields *FieldMapping) Line {
+	line := Line{data: data}
+
+	parsedLine, err := parseJSON(data)
+	if err != nil {
+		if len(bytes.TrimSpace(data)) == 0 {
+			line.status = ParseEmpty
+		} else {
+			line.status = ParseInvalid
+		}
+		return line
+	}
+
+	entryData, ok := parsedLine.Data().(map[string]interface{})
+	if !ok {
+		line.status = ParseNotObject
+		return line
+	}
 
+	line.entry.data = entryData
+	line.entry.extract(fields)
+	return line
+}
+
+// parseJSON parses a single JSON value. Numbers are kept as json.Number so
+// that large ids and nanosecond timestamps don't lose precision
+func parseJSON(data []byte) (*gabs.Container, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	parsed, err := gabs.ParseJSONDecoder(dec)
 	if err != nil {
-		entry := LogEntry{"", "", "", nil}
-		return Line{data, entry}
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON value")
 	}
+	return parsed, nil
+}
 
-	timestamp := parsedLine.Path("timestamp").Data().(string)
-	level := parsedLine.Path("level").Data().(string)
-	message := parsedLine.Path("message").Data().(string)
-	entryData := parsedLine.Data().(map[string]interface{})
-	entry := LogEntry{timestamp, level, message, entryData}
-	return Line{data, entry}
+// extract fills the timestamp, level and message from the entry's data
+func (e *LogEntry) extract(fields *FieldMapping) {
+	if fields == nil {
+		return
+	}
+	v, _ := lookup(e.data, fields.Timestamp)
+	e.timestamp = valueToString(v)
+	e.time, _ = parseTimeValue(v, fields.Layouts)
+	v, _ = lookup(e.data, fields.Level)
+	e.level = valueToString(v)
+	e.severity = ParseLevel(v)
+	v, _ = lookup(e.data, fields.Message)
+	e.message = valueToString(v)
 }
 
 // A LineArray simply stores and array of lines and makes it easy to insert
 // and delete in it
 type LineArray struct {
 	lines []Line
+
+	// The lines of a file that is too large to be read into memory. They
+	// come before the lines above, which were appended while following it
+	index *FileIndex
+	// Data appended while the file is still being indexed
+	pending []byte
+
+	// Where the displayed fields are found in the entries of this array
+	fields *FieldMapping
+	// Whether enough lines were seen to settle the field mapping
+	fieldsDetected bool
 }
 
 func Append(slice []Line, data ...Line) []Line {
@@ -101,6 +193,7 @@ func NewLineArray(size int64, reader io.Reader) *LineArray {
 	la := new(LineArray)
 
 	la.lines = make([]Line, 0, 1000)
+	la.fields = fieldMapping
 
 	br := bufio.NewReader(reader)
 	var loaded int
@@ -120,11 +213,14 @@ func NewLineArray(size int64, reader io.Reader) *LineArray {
 		}
 
 		if n >= 1000 && loaded >= 0 {
-			totalLinesNum := int(float64(size) * (float64(n) / float64(loaded)))
-			newSlice := make([]Line, len(la.lines), totalLinesNum+10000)
-			// The copy function is predeclared and works for any slice type.
-			copy(newSlice, la.lines)
-			la.lines = newSlice
+			// A size of 0 means it isn't known, the lines are left to grow
+			if size > 0 {
+				totalLinesNum := int(float64(size) * (float64(n) / float64(loaded)))
+				newSlice := make([]Line, len(la.lines), totalLinesNum+10000)
+				// The copy function is predeclared and works for any slice type.
+				copy(newSlice, la.lines)
+				la.lines = newSlice
+			}
 			loaded = -1
 		}
 
@@ -135,26 +231,210 @@ func NewLineArray(size int64, reader io.Reader) *LineArray {
 		if err != nil {
 			if err == io.EOF {
 				// la.lines = Append(la.lines, Line{data[:], nil, nil, false})
-				la.lines = Append(la.lines, NewLine(data[:]))
+				la.lines = Append(la.lines, NewLine(data[:], la.fields))
 			}
 			// Last line was read
 			break
 		} else {
 			// la.lines = Append(la.lines, Line{data[:len(data)-1], nil, nil, false})
-			la.lines = Append(la.lines, NewLine(data[:len(data)-1]))
+			la.lines = Append(la.lines, NewLine(data[:len(data)-1], la.fields))
 		}
 		n++
+
+		if n == fieldDetectLines {
+			la.detectFields()
+		}
+	}
+
+	if !la.fieldsDetected {
+		la.detectFields()
 	}
 
 	return la
 }
 
+// NewIndexedLineArray returns a line array for a file that is too large to
+// be read into memory. It is empty until its index is started
+func NewIndexedLineArray(file *os.File, size int64) *LineArray {
+	la := new(LineArray)
+	la.index = NewFileIndex(file, size)
+	la.fields = fieldMapping
+	return la
+}
+
+// Len returns the number of lines
+func (la *LineArray) Len() int {
+	if la.index == nil {
+		return len(la.lines)
+	}
+	return la.index.Len() + len(la.lines)
+}
+
+// Line returns line n, lines past the end are empty
+func (la *LineArray) Line(n int) Line {
+	if la.index != nil {
+		if n < la.index.Len() {
+			return la.index.Line(n, la.fields)
+		}
+		n -= la.index.Len()
+	}
+	if n < 0 || n >= len(la.lines) {
+		return Line{}
+	}
+	return la.lines[n]
+}
+
+// parseLine returns line n without putting it in the cache of the index,
+// for going through all the lines
+func (la *LineArray) parseLine(n int, fields *FieldMapping) Line {
+	if la.index != nil && n < la.index.Len() {
+		return NewLine(la.index.ReadLine(n), fields)
+	}
+	return la.Line(n)
+}
+
+// addIndexed adds the offsets found by the indexer of the file
+func (la *LineArray) addIndexed(offsets []int64, indexed int64, done bool) {
+	la.index.add(offsets, indexed, done)
+	if !la.fieldsDetected && (done || la.index.Len() >= fieldDetectLines) {
+		la.detectFields()
+	}
+	if done && la.pending != nil {
+		pending := la.pending
+		la.pending = nil
+		la.AppendBytes(pending)
+	}
+}
+
+// detectFields settles the field mapping from the first lines of the array
+// and extracts the fields of the lines read so far again with it
+func (la *LineArray) detectFields() {
+	if la.index != nil {
+		sample := make([]Line, 0, fieldDetectLines)
+		for n := 0; n < Min(la.index.Len(), fieldDetectLines); n++ {
+			sample = append(sample, la.parseLine(n, nil))
+		}
+		la.fields = fieldMapping.Detect(sample)
+		la.index.cache.Clear()
+		la.fieldsDetected = len(sample) >= fieldDetectLines || la.index.done
+		return
+	}
+
+	sample := la.lines
+	if len(sample) > fieldDetectLines {
+		sample = sample[:fieldDetectLines]
+	}
+	la.fields = fieldMapping.Detect(sample)
+	for i := range la.lines {
+		la.lines[i].entry.extract(la.fields)
+	}
+	la.fieldsDetected = len(sample) >= fieldDetectLines
+}
+
+// AppendBytes adds raw data at the end of the line array. The data continues
+// the last line, which holds whatever came after the last newline so far
+func (la *LineArray) AppendBytes(data []byte) {
+	if la.index != nil && !la.index.done {
+		// The data comes after the part of the file that is being indexed
+		la.pending = append(la.pending, data...)
+		return
+	}
+	if la.index != nil && len(la.lines) == 0 && la.index.Len() > 0 {
+		// The last line of the file is continued, it is kept in memory
+		// from now on
+		data = append(append([]byte{}, la.index.ReadLine(la.index.Len()-1)...), data...)
+		la.index.pop()
+	} else if last := len(la.lines) - 1; last >= 0 {
+		data = append(append([]byte{}, la.lines[last].data...), data...)
+		la.lines = la.lines[:last]
+	}
+
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := data[:i]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		la.lines = append(la.lines, NewLine(line, la.fields))
+		data = data[i+1:]
+	}
+	la.lines = append(la.lines, NewLine(data, la.fields))
+
+	if !la.fieldsDetected {
+		la.detectFields()
+	}
+}
+
+// A SummaryJob is a parse summary being made in the background
+type SummaryJob struct {
+	// How many of the lines have been checked
+	scanned, total int
+}
+
+// A ParseSummary tells how many lines could not be parsed and why
+type ParseSummary struct {
+	lines  int
+	counts map[ParseStatus]int
+	// The first line with each status and why it could not be parsed
+	first map[ParseStatus]int
+	errs  map[ParseStatus]error
+}
+
+// NewParseSummary returns the summary of lines lines, counts holds how many
+// lines have each status that isn't parsed
+func NewParseSummary(lines int, counts map[ParseStatus]int) *ParseSummary {
+	return &ParseSummary{lines, counts, make(map[ParseStatus]int), make(map[ParseStatus]error)}
+}
+
+// SetFirst records line n as the first line with its status if there is
+// none yet. It returns whether the first line of every status counted is
+// known
+func (s *ParseSummary) SetFirst(n int, line *Line) bool {
+	if _, ok := s.first[line.status]; !ok {
+		s.first[line.status] = n
+		_, s.errs[line.status] = parseJSON(line.data)
+	}
+	for status, count := range s.counts {
+		if _, ok := s.first[status]; count > 0 && !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String describes how many lines could not be parsed and why
+func (s *ParseSummary) String() string {
+	failed := 0
+	for _, count := range s.counts {
+		failed += count
+	}
+	if failed == 0 {
+		return fmt.Sprintf("All %d lines were parsed", s.lines)
+	}
+
+	var reasons []string
+	for _, status := range []ParseStatus{ParseInvalid, ParseNotObject} {
+		if s.counts[status] == 0 {
+			continue
+		}
+		reason := fmt.Sprintf("%d %s (first on line %d", s.counts[status], status, s.first[status]+1)
+		if err := s.errs[status]; err != nil {
+			reason += ": " + err.Error()
+		}
+		reasons = append(reasons, reason+")")
+	}
+	return fmt.Sprintf("%d of %d lines could not be parsed: %s", failed, s.lines, strings.Join(reasons, ", "))
+}
+
 // Returns the String representation of the LineArray
 func (la *LineArray) String() string {
 	str := ""
-	for i, l := range la.lines {
-		str += string(l.data)
-		if i != len(la.lines)-1 {
+	for i := 0; i < la.Len(); i++ {
+		str += string(la.Line(i).data)
+		if i != la.Len()-1 {
 			str += "\n"
 		}
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"io/ioutil"
 	"log"
 	"os"
 )
@@ -9,7 +10,12 @@ var (
 	Log *log.Logger
 )
 
+// NewLog creates the debug logger. Nothing is logged if logfile is empty
 func NewLog(logfile string) {
+	if logfile == "" {
+		Log = log.New(ioutil.Discard, "", 0)
+		return
+	}
 	file, err := os.Create(logfile)
 	if err != nil {
 		panic(err)
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	homedir "github.com/mitchellh/go-homedir"
 	"github.com/zyedidia/tcell"
 )
 
@@ -14,8 +18,6 @@ var (
 	// Object to send messages and prompts to the user
 	messenger *Messenger
 
-	view *View
-
 	// The default highlighting style
 	// This simply defines the default foreground and background colors
 	defStyle tcell.Style
@@ -24,27 +26,94 @@ var (
 	jobs chan JobFunction
 	// Event channel
 	events chan tcell.Event
+
+	// Where the config files are stored
+	configDir string
+
+	// Command line flags
+	flagFollow       = flag.Bool("f", false, "Follow the file as it grows, like tail -f")
+	flagConfigDir    = flag.String("config-dir", "", "Specify a custom location for the configuration directory")
+	flagTimestampKey = flag.String("timestamp-key", "", "Comma separated `paths` of the timestamp field, tried in order")
+	flagLevelKey     = flag.String("level-key", "", "Comma separated `paths` of the level field, tried in order")
+	flagMessageKey   = flag.String("message-key", "", "Comma separated `paths` of the message field, tried in order")
+	flagSince        = flag.String("since", "", "Only show entries at or after this `time` (14:32, 2024-05-01T14:32Z, -15m)")
+	flagUntil        = flag.String("until", "", "Only show entries at or before this `time`")
+	flagTimeLayout   = flag.String("time-layout", "", "Go `layout` of the timestamps, tried before the known layouts")
+	flagTime         = flag.String("time", "", "Display timestamps in utc, local or relative time")
+	flagDelta        = flag.Bool("delta", false, "Display the time since the previous line")
+	flagColorscheme  = flag.String("colorscheme", "", "The `name` of the colorscheme, built-in or in the colorschemes directory of the config directory")
+	flagLevel        = flag.String("level", "", "Hide the entries less severe than this `level` (trace, debug, info, warn, error, fatal)")
+	flagLog          = flag.String("log", "", "Write debug messages to this `file`")
 )
 
 func main() {
-	logfile := os.Args[2]
-	NewLog(logfile)
-	Log.Println("Started - log", logfile)
+	flag.Usage = func() {
+		fmt.Println("Usage: jv [OPTIONS] [FILE]...")
+		fmt.Println("Reads from stdin when FILE is - or when stdin is a pipe")
+		fmt.Println("Several files, or glob patterns such as 'logs/*.log', are merged into one view ordered by time")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 && isTerminal(os.Stdin) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	NewLog(*flagLog)
+	Log.Println("Started - log", *flagLog)
 
-	InitBindings()
+	InitConfigDir()
+	settingsErrs := InitGlobalSettings()
+	// The flags override the settings for this session
+	for option, value := range map[string]string{"time": *flagTime, "colorscheme": *flagColorscheme, "level": *flagLevel} {
+		if value == "" {
+			continue
+		}
+		if err := OverrideOption(option, value); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *flagDelta {
+		OverrideOption("delta", "true")
+	}
+	InitFieldMapping()
+	InitColumns()
+	if GetOption("delta").(bool) && !hasDeltaColumn() {
+		toggleDeltaColumn()
+	}
+	bindingErrs := InitBindings()
+	InitCommands()
+	InitColorscheme()
 
 	InitScreen()
-	buffer := LoadInput()
 
 	jobs = make(chan JobFunction, 100)
 	events = make(chan tcell.Event, 100)
 
+	buffer := LoadInput()
+
 	// Create a new messenger
 	// This is used for sending the user messages in the bottom of the editor
 	messenger = new(Messenger)
 	messenger.history = make(map[string][]string)
+	reportErrors(append(settingsErrs, bindingErrs...))
 
-	view = NewView(buffer)
+	view := AddTab(buffer)
+
+	if *flagSince != "" || *flagUntil != "" {
+		since, until, err := ParseTimeWindow(*flagSince+".."+*flagUntil, view.CurrentTime())
+		if err != nil {
+			screen.Fini()
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		view.SetTimeWindow(since, until)
+	}
+	if minLevel, _ := ParseLevelInput(GetOption("level").(string)); minLevel != LevelUnknown {
+		view.SetMinLevel(minLevel)
+	}
 
 	go func() {
 		for {
@@ -72,7 +141,7 @@ func main() {
 		for event != nil {
 			switch event.(type) {
 			case *tcell.EventResize:
-				// view.Resize()
+				ResizeAll()
 			}
 
 			if searching {
@@ -94,21 +163,51 @@ func main() {
 	}
 }
 
+// LoadInput creates the buffer for the files given on the command line.
+// The buffer is read from stdin when the file is "-" or when no file is
+// given and stdin is not a terminal. Several files are merged into one
+// buffer
 func LoadInput() *Buffer {
-	filename := os.Args[1]
+	filename := flag.Arg(0)
+
+	if flag.NArg() <= 1 && (filename == "-" || (filename == "" && !isTerminal(os.Stdin))) {
+		buffer := NewBufferFromString("", "")
+		buffer.name = "stdin"
+		StreamInput(buffer, os.Stdin)
+		return buffer
+	}
+
+	files := ExpandGlobs(flag.Args())
+	if len(files) > 1 {
+		return LoadMerged(files)
+	}
+	filename = files[0]
 
 	var buffer *Buffer
 	if _, e := os.Stat(filename); e == nil {
 		input, err := os.Open(filename)
-		stat, _ := input.Stat()
-		defer input.Close()
 		if err != nil {
 			panic(err)
 		}
+		stat, _ := input.Stat()
 		if stat.IsDir() {
 			TermMessage("Cannot read", filename, "because it is a directory")
 		}
-		buffer = NewBuffer(input, FSize(input), filename)
+		var offset int64
+		buffer, offset, err = NewBufferFromFile(input, filename)
+		if err != nil {
+			TermMessage("Error reading", filename+":", err)
+		}
+		// A compressed file can't be followed, whatever is appended to it
+		// only makes sense to the decompressor
+		if *flagFollow && buffer.compression == nil {
+			// The follower takes over the file and keeps reading from where
+			// the buffer stopped
+			buffer.follower = NewFollower(buffer, input, offset)
+			buffer.follower.Start()
+		} else {
+			input.Close()
+		}
 	} else {
 		TermMessage("File not found", filename)
 	}
@@ -116,6 +215,66 @@ func LoadInput() *Buffer {
 	return buffer
 }
 
+// LoadMerged creates the buffer merging several files, with a column
+// telling which file each line comes from
+func LoadMerged(files []string) *Buffer {
+	buffer, errs := NewMergedBuffer(files)
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		TermMessage("Error reading", strings.Join(msgs, "\n"))
+	}
+	if *flagFollow {
+		TermMessage("Cannot follow several files, they are only read once")
+	}
+	return buffer
+}
+
+// ExpandGlobs replaces the glob patterns among the arguments by the files
+// matching them, in case the shell didn't. Patterns matching nothing are
+// kept so they are reported as missing files
+func ExpandGlobs(args []string) []string {
+	var files []string
+	for _, arg := range args {
+		matches, _ := filepath.Glob(arg)
+		if len(matches) == 0 {
+			matches = []string{arg}
+		}
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// InitConfigDir finds the configuration directory for jv according to the
+// XDG spec, it can be overridden with the -config-dir flag
+func InitConfigDir() {
+	if *flagConfigDir != "" {
+		configDir = ReplaceHome(*flagConfigDir)
+		if _, err := os.Stat(configDir); os.IsNotExist(err) {
+			TermMessage("Error: " + configDir + " does not exist. Defaulting to " + defaultConfigDir() + ".")
+		} else {
+			return
+		}
+	}
+	configDir = defaultConfigDir()
+}
+
+// defaultConfigDir returns $XDG_CONFIG_HOME/jv, or ~/.config/jv if the
+// variable isn't set
+func defaultConfigDir() string {
+	xdgHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgHome == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return ""
+		}
+		xdgHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(xdgHome, "jv")
+}
+
 func InitScreen() {
 	// Should we enable true color?
 	truecolor := os.Getenv("JV_TRUECOLOR") == "1"
@@ -151,6 +310,16 @@ func InitScreen() {
 	screen.SetStyle(defStyle)
 }
 
+// ResizeAll lays out the views of every tab again, after the screen was
+// resized or the tabbar appeared or went away. The tabbar, the statuslines
+// and the messenger are drawn from the sizes of the screen and the views,
+// they follow on the next redraw
+func ResizeAll() {
+	for _, t := range tabs {
+		t.Resize()
+	}
+}
+
 // RedrawAll redraws everything -- all the views and the messenger
 func RedrawAll() {
 	messenger.Clear()
@@ -162,15 +331,12 @@ func RedrawAll() {
 		}
 	}
 
-	view.Display()
+	tabs[curTab].Display()
+	DisplayTabs()
 	messenger.Display()
 	screen.Show()
 }
 
-func CurView() *View {
-	return view
-}
-
 // logfile := "/Users/fcoury/logs/jvg.log"
 // var dlog *log.Logger
 // if logfile != "" {
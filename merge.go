@@ -0,0 +1,246 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/zyedidia/tcell"
+)
+
+// How many source.<n> colour groups the colorschemes define, the sources
+// cycle through them
+const sourceColors = 6
+
+// A Source is one of the files merged into a buffer
+type Source struct {
+	// The short name shown in the source column
+	Name string
+	Path string
+
+	// The position of the file on the command line, it picks the colour
+	index int
+}
+
+// Style returns the style of the source's cells in the source column
+func (s *Source) Style() tcell.Style {
+	return GetColor("source." + strconv.Itoa(s.index%sourceColors+1))
+}
+
+// NewSources returns the sources for a list of files. Each is named after
+// its file without the extensions, such as api for api.log.1.gz, unless
+// that would give two sources the same name
+func NewSources(paths []string) []*Source {
+	sources := make([]*Source, len(paths))
+	count := make(map[string]int)
+	for i, path := range paths {
+		name := filepath.Base(path)
+		if j := strings.Index(name, "."); j > 0 {
+			name = name[:j]
+		}
+		sources[i] = &Source{Name: name, Path: path, index: i}
+		count[name]++
+	}
+	for _, s := range sources {
+		if count[s.Name] > 1 {
+			s.Name = filepath.Base(s.Path)
+		}
+	}
+	for i, s := range sources {
+		// Only the same file given twice can still clash
+		for _, other := range sources[:i] {
+			if other.Name == s.Name {
+				s.Name += "#" + strconv.Itoa(i+1)
+				break
+			}
+		}
+	}
+	return sources
+}
+
+// NewMergedBuffer reads several files and merges their lines into a single
+// buffer ordered by time. Each line is tagged with the file it comes from.
+// The files are read into memory whatever their size and are not followed.
+// Files that can't be read are left out and their errors are returned
+func NewMergedBuffer(paths []string) (*Buffer, []error) {
+	var errs []error
+	var arrays [][]Line
+	var read []string
+	for _, path := range paths {
+		la, err := readLineArray(path)
+		if err != nil {
+			errs = append(errs, err)
+			if la == nil {
+				continue
+			}
+		}
+		lines := la.lines
+		if n := len(lines); n > 1 && len(lines[n-1].data) == 0 {
+			// Only the end of the buffer has a line after the last newline
+			lines = lines[:n-1]
+		}
+		arrays = append(arrays, lines)
+		read = append(read, path)
+	}
+
+	sources := NewSources(read)
+	for i, lines := range arrays {
+		for j := range lines {
+			lines[j].source = sources[i]
+		}
+	}
+
+	b := NewBufferFromString("", "")
+	if lines := mergeLines(arrays); len(lines) > 0 {
+		b.lines = lines
+	}
+	// Every line was parsed with the fields of its own file
+	b.fieldsDetected = true
+	b.fastdirty = true
+	b.Sources = sources
+	b.sourceColumn = sourceColumn(sources)
+
+	names := make([]string, len(read))
+	for i, path := range read {
+		names[i] = filepath.Base(path)
+	}
+	b.name = strings.Join(names, ", ")
+	b.Update()
+	return b, errs
+}
+
+// readLineArray reads a whole file into a line array, decompressing it if
+// needed. The lines read before an error are returned with it
+func readLineArray(path string) (*LineArray, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if info, _ := file.Stat(); info != nil && info.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: path, Err: errors.New("is a directory")}
+	}
+
+	size := FSize(file)
+	input, compression, err := Decompress(file)
+	if err != nil {
+		return nil, &os.PathError{Op: "decompress", Path: path, Err: err}
+	}
+	if compression != nil {
+		size = compression.DecompressedSize(file, size)
+	}
+	la := NewLineArray(size, input)
+	if err := decompressErr(input); err != nil {
+		return la, &os.PathError{Op: "decompress", Path: path, Err: err}
+	}
+	return la, nil
+}
+
+// mergeLines merges the lines of several files into one list ordered by
+// time. Lines without a timestamp, such as the lines of a stack trace,
+// stay right after the line they follow in their file. Each file is
+// assumed to be in order already, lines with the same time are taken from
+// the files in the order they were given
+func mergeLines(arrays [][]Line) []Line {
+	total := 0
+	h := make(mergeHeap, 0, len(arrays))
+	for i, lines := range arrays {
+		total += len(lines)
+		if len(lines) > 0 {
+			c := &mergeCursor{lines: lines, file: i}
+			c.advance(0)
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+
+	merged := make([]Line, 0, total)
+	for len(h) > 0 {
+		c := h[0]
+		merged = append(merged, c.lines[c.pos])
+		if c.pos+1 < len(c.lines) {
+			c.advance(c.pos + 1)
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return merged
+}
+
+// A mergeCursor is the position of the merge in the lines of a file
+type mergeCursor struct {
+	lines []Line
+	pos   int
+	file  int
+	// The time the next line is sorted by
+	time time.Time
+}
+
+// advance moves the cursor to line pos. A line without a timestamp is
+// sorted by the time of the line before it
+func (c *mergeCursor) advance(pos int) {
+	c.pos = pos
+	if t, ok := c.lines[pos].Time(); ok {
+		c.time = t
+	}
+}
+
+// A mergeHeap gives the file whose next line comes first
+type mergeHeap []*mergeCursor
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].time.Equal(h[j].time) {
+		return h[i].file < h[j].file
+	}
+	return h[i].time.Before(h[j].time)
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeCursor)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// sourceColumn returns a column showing the source of each line, as wide
+// as the longest name
+func sourceColumn(sources []*Source) *Column {
+	width := 0
+	for _, s := range sources {
+		width = Max(width, runewidth.StringWidth(s.Name))
+	}
+	return &Column{Path: "source", Width: width}
+}
+
+// Columns returns the columns the buffer is shown with, its source column
+// in front of the other columns unless they already show the source
+func (b *Buffer) Columns() []*Column {
+	if b.sourceColumn == nil {
+		return columns
+	}
+	for _, c := range columns {
+		if c.Path == "source" {
+			return columns
+		}
+	}
+	return append([]*Column{b.sourceColumn}, columns...)
+}
+
+// FindSource returns the source of the buffer with the given name
+func (b *Buffer) FindSource(name string) *Source {
+	for _, s := range b.Sources {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
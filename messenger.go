@@ -27,7 +27,15 @@ func TermMessage(msg ...interface{}) {
 	fmt.Println(msg...)
 	fmt.Print("\nPress enter to continue")
 
-	reader := bufio.NewReader(os.Stdin)
+	// stdin may be the log being read, the answer has to come from the terminal
+	input := os.Stdin
+	if !isTerminal(input) {
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			defer tty.Close()
+			input = tty
+		}
+	}
+	reader := bufio.NewReader(input)
 	reader.ReadString('\n')
 
 	if !screenWasNil {
@@ -56,6 +64,8 @@ type Messenger struct {
 	response string
 	// style to use when drawing the message
 	style tcell.Style
+	// A problem with the response, shown after it
+	promptError string
 
 	// We have to keep track of the cursor for prompting
 	cursorx int
@@ -93,11 +103,7 @@ func (m *Messenger) Message(msg ...interface{}) {
 		// if there is no active prompt then style and display the message as normal
 		m.message = displayMessage
 
-		m.style = defStyle
-
-		// if _, ok := colorscheme["message"]; ok {
-		// 	m.style = colorscheme["message"]
-		// }
+		m.style = GetColor("message")
 
 		m.hasMessage = true
 	}
@@ -115,29 +121,32 @@ func (m *Messenger) Error(msg ...interface{}) {
 	if m.hasPrompt == false {
 		// if there is no active prompt then style and display the message as normal
 		m.message = buf.String()
-		m.style = defStyle.
-			Foreground(tcell.ColorBlack).
-			Background(tcell.ColorMaroon)
-
-		// if _, ok := colorscheme["error-message"]; ok {
-		// 	m.style = colorscheme["error-message"]
-		// }
+		m.style = GetColor("error-message")
 		m.hasMessage = true
 	}
 	// add the message to the log regardless of active prompts
 	m.AddLog(buf.String())
 }
 
+// reportErrors shows the first of the problems found in a config file
+// and how many more there are
+func reportErrors(errs []error) {
+	if len(errs) == 0 {
+		return
+	}
+	if len(errs) == 1 {
+		messenger.Error(errs[0])
+		return
+	}
+	messenger.Error(errs[0], " (and ", len(errs)-1, " more)")
+}
+
 func (m *Messenger) PromptText(msg ...interface{}) {
 	displayMessage := fmt.Sprint(msg...)
 	// if there is no active prompt then style and display the message as normal
 	m.message = displayMessage
 
-	m.style = defStyle
-
-	// if _, ok := colorscheme["message"]; ok {
-	// 	m.style = colorscheme["message"]
-	// }
+	m.style = GetColor("message")
 
 	m.hasMessage = true
 	// add the message to the log regardless of active prompts
@@ -149,15 +158,18 @@ func (m *Messenger) YesNoPrompt(prompt string) (bool, bool) {
 	m.hasPrompt = true
 	m.PromptText(prompt)
 
-	_, h := screen.Size()
 	for {
 		m.Clear()
 		m.Display()
+		_, h := screen.Size()
 		screen.ShowCursor(Count(m.message), h-1)
 		screen.Show()
 		event := <-events
 
 		switch e := event.(type) {
+		case *tcell.EventResize:
+			ResizeAll()
+			RedrawAll()
 		case *tcell.EventKey:
 			switch e.Key() {
 			case tcell.KeyRune:
@@ -186,15 +198,18 @@ func (m *Messenger) LetterPrompt(prompt string, responses ...rune) (rune, bool)
 	m.hasPrompt = true
 	m.PromptText(prompt)
 
-	_, h := screen.Size()
 	for {
 		m.Clear()
 		m.Display()
+		_, h := screen.Size()
 		screen.ShowCursor(Count(m.message), h-1)
 		screen.Show()
 		event := <-events
 
 		switch e := event.(type) {
+		case *tcell.EventResize:
+			ResizeAll()
+			RedrawAll()
 		case *tcell.EventKey:
 			switch e.Key() {
 			case tcell.KeyRune:
@@ -229,6 +244,8 @@ const (
 	PluginCmdCompletion
 	PluginNameCompletion
 	OptionValueCompletion
+	ColorschemeCompletion
+	SourceCompletion
 )
 
 // Prompt sends the user a message and waits for a response to be typed in
@@ -249,12 +266,14 @@ func (m *Messenger) Prompt(prompt, placeholder, historyType string, completionTy
 
 	RedrawAll()
 	for m.hasPrompt {
-		// var suggestions []string
+		var suggestions []string
 		m.Clear()
 
 		event := <-events
 
 		switch e := event.(type) {
+		case *tcell.EventResize:
+			ResizeAll()
 		case *tcell.EventKey:
 			switch e.Key() {
 			case tcell.KeyCtrlQ, tcell.KeyCtrlC, tcell.KeyEscape:
@@ -267,13 +286,19 @@ func (m *Messenger) Prompt(prompt, placeholder, historyType string, completionTy
 				m.hasPrompt = false
 				response, canceled = m.response, false
 				m.history[historyType][len(m.history[historyType])-1] = response
+			case tcell.KeyTab:
+				suggestions = m.complete(completionTypes)
 			}
 		}
 
 		m.HandleEvent(event, m.history[historyType])
 
 		m.Clear()
-		view.Display()
+		tabs[curTab].Display()
+		DisplayTabs()
+		if len(suggestions) > 1 {
+			m.DisplaySuggestions(suggestions)
+		}
 		m.Display()
 		screen.Show()
 	}
@@ -283,6 +308,63 @@ func (m *Messenger) Prompt(prompt, placeholder, historyType string, completionTy
 	return response, canceled
 }
 
+// complete completes the argument under the cursor of the response. The
+// completion of each argument is given by completionTypes, the last one
+// is used for the arguments after them. When the first argument is a
+// command the completions of the command are used for its arguments.
+// The suggestions are returned so they can be shown when there are several
+func (m *Messenger) complete(completionTypes []Completion) []string {
+	if len(completionTypes) == 0 {
+		return nil
+	}
+
+	args := SplitCommandArgs(m.response)
+	currentArgNum := len(args) - 1
+	currentArg := args[currentArgNum]
+
+	if completionTypes[0] == CommandCompletion && currentArgNum > 0 {
+		if command, ok := commands[args[0]]; ok {
+			completionTypes = append([]Completion{CommandCompletion}, command.completions...)
+		}
+	}
+
+	var completionType Completion
+	if currentArgNum >= len(completionTypes) {
+		completionType = completionTypes[len(completionTypes)-1]
+	} else {
+		completionType = completionTypes[currentArgNum]
+	}
+
+	var chosen string
+	var suggestions []string
+	switch completionType {
+	case FileCompletion:
+		chosen, suggestions = FileComplete(currentArg)
+	case CommandCompletion:
+		chosen, suggestions = CommandComplete(currentArg)
+	case OptionCompletion:
+		chosen, suggestions = OptionComplete(currentArg)
+	case OptionValueCompletion:
+		if currentArgNum > 1 {
+			chosen, suggestions = OptionValueComplete(args[currentArgNum-1], currentArg)
+		}
+	case ColorschemeCompletion:
+		chosen, suggestions = ColorschemeComplete(currentArg)
+	case SourceCompletion:
+		chosen, suggestions = SourceComplete(currentArg)
+	}
+
+	if len(suggestions) > 1 {
+		chosen = chosen + CommonSubstring(suggestions...)
+	}
+
+	if len(suggestions) != 0 && chosen != "" {
+		m.response = JoinCommandArgs(append(args[:len(args)-1], chosen)...)
+		m.cursorx = Count(m.response)
+	}
+	return suggestions
+}
+
 // HandleEvent handles an event for the prompter
 func (m *Messenger) HandleEvent(event tcell.Event, history []string) {
 	switch e := event.(type) {
@@ -335,6 +417,7 @@ func (m *Messenger) Reset() {
 	m.cursorx = 0
 	m.message = ""
 	m.response = ""
+	m.promptError = ""
 }
 
 // Clear clears the line at the bottom of the editor
@@ -350,10 +433,7 @@ func (m *Messenger) DisplaySuggestions(suggestions []string) {
 
 	y := screenH - 2
 
-	statusLineStyle := defStyle.Reverse(true)
-	// if style, ok := colorscheme["statusline"]; ok {
-	// 	statusLineStyle = style
-	// }
+	statusLineStyle := GetColor("statusline")
 
 	for x := 0; x < w; x++ {
 		screen.SetContent(x, y, ' ', nil, statusLineStyle)
@@ -373,16 +453,20 @@ func (m *Messenger) DisplaySuggestions(suggestions []string) {
 // Display displays messages or prompts
 func (m *Messenger) Display() {
 	_, h := screen.Size()
-	if m.hasMessage {
-		// if m.hasPrompt || globalSettings["infobar"].(bool) {
+	if m.hasMessage && (m.hasPrompt || GetOption("infobar").(bool)) {
 		runes := []rune(m.message + m.response)
 		posx := 0
 		for x := 0; x < len(runes); x++ {
 			screen.SetContent(posx, h-1, runes[x], nil, m.style)
 			posx += runewidth.RuneWidth(runes[x])
 		}
-		// if m.hasPrompt {
-		// }
+		if m.hasPrompt && m.promptError != "" {
+			posx++
+			for _, r := range m.promptError {
+				screen.SetContent(posx, h-1, r, nil, GetColor("error-message"))
+				posx += runewidth.RuneWidth(r)
+			}
+		}
 	}
 
 	if m.hasPrompt {
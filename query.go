@@ -0,0 +1,572 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Query is a filter expression over the fields of log entries, such as
+//
+//	level in (error, warn) and http.status >= 500 and message ~ /timeout/
+//
+// Fields are JSON paths into the entry, with timestamp, level and message
+// standing for the mapped fields. Values are compared as numbers when the
+// value in the query is a number, as times when both sides are times and
+// as strings otherwise, string equality ignores case. The operators are
+// = != < <= > >= ~ (regexp match) !~ in, "exists field" checks that a
+// field is present and expressions combine with and, or, not and
+// parentheses
+type Query struct {
+	text string
+	root queryNode
+}
+
+// A QueryError is a syntax error in a query
+type QueryError struct {
+	// The column the error was found at, starting at 1
+	Col int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Col)
+}
+
+// ParseQuery parses a filter expression
+func ParseQuery(text string) (*Query, error) {
+	tokens, err := lexQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	return &Query{text, root}, nil
+}
+
+// String returns the text the query was parsed from
+func (q *Query) String() string {
+	return q.text
+}
+
+// Match returns whether a line satisfies the query
+func (q *Query) Match(line *Line) bool {
+	return q.root.match(line)
+}
+
+// fieldValue returns the value of a field of a line for queries
+func fieldValue(line *Line, field string) (interface{}, bool) {
+	if field == "source" && line.source != nil {
+		return line.source.Name, true
+	}
+	if line.status != ParseOK {
+		return nil, false
+	}
+	switch field {
+	case "timestamp":
+		return line.entry.timestamp, line.entry.timestamp != ""
+	case "level":
+		if line.entry.severity != LevelUnknown {
+			return line.entry.severity.String(), true
+		}
+		return line.entry.level, line.entry.level != ""
+	case "message":
+		return line.entry.message, line.entry.message != ""
+	}
+	return lookupPath(line.entry.data, field)
+}
+
+// toFloat converts a JSON value to a number if it is one
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokRegex
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	// Column of the token, starting at 1
+	col int
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return strconv.Quote(t.text)
+	case tokRegex:
+		return "/" + t.text + "/"
+	}
+	return "\"" + t.text + "\""
+}
+
+// Characters that start an operator and end a bare word
+const queryOpChars = "=!<>~&|"
+
+// lexQuery splits a query into tokens
+func lexQuery(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		col := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{tokLParen, "(", col})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{tokRParen, ")", col})
+			i++
+		case r == ',':
+			tokens = append(tokens, queryToken{tokComma, ",", col})
+			i++
+		case r == '"' || r == '\'':
+			// Strings may use either quote and backslash escapes
+			var str []rune
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				str = append(str, runes[j])
+			}
+			if j >= len(runes) {
+				return nil, &QueryError{col, "unterminated string"}
+			}
+			tokens = append(tokens, queryToken{tokString, string(str), col})
+			i = j + 1
+		case r == '/':
+			// Regular expressions are written /like this/ and may end with
+			// an i for case insensitive matching
+			var re []rune
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '/'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) && runes[j+1] == '/' {
+					j++
+				}
+				re = append(re, runes[j])
+			}
+			if j >= len(runes) {
+				return nil, &QueryError{col, "unterminated regular expression"}
+			}
+			j++
+			if j < len(runes) && runes[j] == 'i' {
+				re = append([]rune("(?i)"), re...)
+				j++
+			}
+			tokens = append(tokens, queryToken{tokRegex, string(re), col})
+			i = j
+		case strings.ContainsRune(queryOpChars, r):
+			j := i + 1
+			for j < len(runes) && j-i < 2 && strings.ContainsRune(queryOpChars, runes[j]) {
+				j++
+			}
+			op := string(runes[i:j])
+			switch op {
+			case "=", "==", "!=", "<", "<=", ">", ">=", "~", "!~", "=~", "&&", "||", "!":
+			default:
+				return nil, &QueryError{col, "unknown operator " + op}
+			}
+			tokens = append(tokens, queryToken{tokOp, op, col})
+			i = j
+		default:
+			// A bare word: a field, a keyword, a number or an unquoted value
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("(),\"'"+queryOpChars, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, queryToken{tokWord, string(runes[i:j]), col})
+			i = j
+		}
+	}
+	return append(tokens, queryToken{tokEOF, "", utf8.RuneCountInString(text) + 1}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword returns whether the next token is the given keyword or operator
+func (p *queryParser) keyword(words ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokWord && tok.kind != tokOp {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(tok.text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *queryParser) errorf(tok queryToken, format string, args ...interface{}) error {
+	return &QueryError{tok.col, fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or", "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and", "&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.keyword("not", "!") {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.peek()
+	if tok.kind == tokLParen {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, p.errorf(closing, "expected \")\" but found %s", closing)
+		}
+		return node, nil
+	}
+
+	if p.keyword("exists") {
+		p.next()
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		return &existsNode{field}, nil
+	}
+
+	field, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+
+	negate := false
+	if p.keyword("not") {
+		p.next()
+		negate = true
+		if !p.keyword("in") {
+			return nil, p.errorf(p.peek(), "expected \"in\" after \"not\" but found %s", p.peek())
+		}
+	}
+	if p.keyword("in") {
+		p.next()
+		node, err := p.parseList(field)
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			return &notNode{node}, nil
+		}
+		return node, nil
+	}
+
+	op := p.next()
+	if op.kind != tokOp || op.text == "&&" || op.text == "||" || op.text == "!" {
+		return nil, p.errorf(op, "expected an operator after %q but found %s", field, op)
+	}
+
+	value := p.next()
+	if value.kind != tokWord && value.kind != tokString && value.kind != tokRegex {
+		return nil, p.errorf(value, "expected a value after %q but found %s", op.text, value)
+	}
+
+	switch op.text {
+	case "~", "=~", "!~":
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, p.errorf(value, "invalid regular expression: %s", err)
+		}
+		var node queryNode = &matchNode{field, re}
+		if op.text == "!~" {
+			node = &notNode{node}
+		}
+		return node, nil
+	}
+	if value.kind == tokRegex {
+		return nil, p.errorf(value, "regular expressions can only be used with ~ and !~")
+	}
+
+	cmp := &compareNode{field, op.text, newQueryValue(value)}
+	if op.text == "!=" {
+		cmp.op = "="
+		return &notNode{cmp}, nil
+	}
+	if op.text == "==" {
+		cmp.op = "="
+	}
+	return cmp, nil
+}
+
+// parseField parses the name of a field
+func (p *queryParser) parseField() (string, error) {
+	tok := p.next()
+	if tok.kind != tokWord && tok.kind != tokString {
+		return "", p.errorf(tok, "expected a field name but found %s", tok)
+	}
+	return tok.text, nil
+}
+
+// parseList parses the parenthesized list of values after "in"
+func (p *queryParser) parseList(field string) (queryNode, error) {
+	if tok := p.next(); tok.kind != tokLParen {
+		return nil, p.errorf(tok, "expected \"(\" after \"in\" but found %s", tok)
+	}
+	node := &inNode{field: field}
+	for {
+		tok := p.next()
+		if tok.kind != tokWord && tok.kind != tokString {
+			return nil, p.errorf(tok, "expected a value in the list but found %s", tok)
+		}
+		node.values = append(node.values, newQueryValue(tok))
+
+		tok = p.next()
+		if tok.kind == tokRParen {
+			return node, nil
+		}
+		if tok.kind != tokComma {
+			return nil, p.errorf(tok, "expected \",\" or \")\" but found %s", tok)
+		}
+	}
+}
+
+// A queryValue is a literal value in a query, parsed in advance as a number
+// and a time if possible
+type queryValue struct {
+	text string
+
+	num   float64
+	isNum bool
+
+	time   time.Time
+	isTime bool
+}
+
+func newQueryValue(tok queryToken) queryValue {
+	v := queryValue{text: tok.text}
+	if tok.kind == tokWord {
+		if f, err := strconv.ParseFloat(tok.text, 64); err == nil {
+			v.num, v.isNum = f, true
+		}
+	}
+	if !v.isNum {
+		v.time, v.isTime = parseTimestamp(tok.text)
+	}
+	return v
+}
+
+type queryNode interface {
+	match(line *Line) bool
+}
+
+type orNode struct {
+	left, right queryNode
+}
+
+func (n *orNode) match(line *Line) bool {
+	return n.left.match(line) || n.right.match(line)
+}
+
+type andNode struct {
+	left, right queryNode
+}
+
+func (n *andNode) match(line *Line) bool {
+	return n.left.match(line) && n.right.match(line)
+}
+
+type notNode struct {
+	node queryNode
+}
+
+func (n *notNode) match(line *Line) bool {
+	return !n.node.match(line)
+}
+
+type existsNode struct {
+	field string
+}
+
+func (n *existsNode) match(line *Line) bool {
+	_, ok := fieldValue(line, n.field)
+	return ok
+}
+
+type matchNode struct {
+	field string
+	re    *regexp.Regexp
+}
+
+func (n *matchNode) match(line *Line) bool {
+	v, ok := fieldValue(line, n.field)
+	return ok && n.re.MatchString(valueToString(v))
+}
+
+type inNode struct {
+	field  string
+	values []queryValue
+}
+
+func (n *inNode) match(line *Line) bool {
+	v, ok := fieldValue(line, n.field)
+	if !ok {
+		return false
+	}
+	for _, value := range n.values {
+		if compareValues(v, "=", value) {
+			return true
+		}
+	}
+	return false
+}
+
+type compareNode struct {
+	field string
+	op    string
+	value queryValue
+}
+
+func (n *compareNode) match(line *Line) bool {
+	v, ok := fieldValue(line, n.field)
+	return ok && compareValues(v, n.op, n.value)
+}
+
+// compareValues compares a value from an entry with a value from a query
+func compareValues(v interface{}, op string, value queryValue) bool {
+	var c int
+	switch {
+	case value.isNum:
+		f, ok := toFloat(v)
+		if !ok {
+			return false
+		}
+		switch {
+		case f < value.num:
+			c = -1
+		case f > value.num:
+			c = 1
+		}
+	case value.isTime:
+		t, ok := parseTimestamp(valueToString(v))
+		if !ok {
+			return compareStrings(valueToString(v), op, value.text)
+		}
+		switch {
+		case t.Before(value.time):
+			c = -1
+		case t.After(value.time):
+			c = 1
+		}
+	default:
+		return compareStrings(valueToString(v), op, value.text)
+	}
+	return compareResult(c, op)
+}
+
+func compareStrings(a, op, b string) bool {
+	if op == "=" {
+		return strings.EqualFold(a, b)
+	}
+	return compareResult(strings.Compare(a, b), op)
+}
+
+// compareResult tells if the result of a comparison satisfies op
+func compareResult(c int, op string) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// A RowIndex maps the rows shown by a view to the lines of its buffer.
+// Without a filter every line is shown and row N is line N, otherwise the
+// index holds the numbers of the lines that pass the filter.
+// The index catches up by itself when lines are appended to the buffer,
+// only the new lines (and the last line, which may have grown) are checked.
+// The lines of an indexed file are checked in the background, the rows
+// come in as they are found
+type RowIndex struct {
+	buf *Buffer
+
+	// Tells whether a line is shown, nil shows every line
+	filter func(line *Line) bool
+	// The buffer lines that are shown when there is a filter
+	rows []int
+
+	// The line array and version of the buffer the index was built from
+	la      *LineArray
+	version int
+	// How many lines of the buffer have been checked against the filter
+	scanned int
+	// Changes whenever the rows may have changed
+	generation int
+	// Changes when the index is rebuilt, rows may have been removed or
+	// moved. Otherwise rows are only added at the end, after the last
+	// row which may have changed
+	rebuilds int
+
+	// The scan checking the lines in the background, nil when there is none,
+	// and how many of its lines it has checked so far
+	filtering *RowScan
+	filtered  int
+	// Cancels the scan when incremented
+	scanCount int64
+}
+
+// NewRowIndex returns an index showing every line of buf
+func NewRowIndex(buf *Buffer) *RowIndex {
+	ri := &RowIndex{buf: buf}
+	ri.Rebuild()
+	return ri
+}
+
+// SetFilter changes the filter and rebuilds the index
+func (ri *RowIndex) SetFilter(filter func(line *Line) bool) {
+	ri.filter = filter
+	ri.Rebuild()
+}
+
+// Rebuild checks every line of the buffer against the filter again
+func (ri *RowIndex) Rebuild() {
+	ri.generation++
+	ri.rebuilds++
+	ri.rows = nil
+	ri.scanned = 0
+	ri.filtering = nil
+	atomic.AddInt64(&ri.scanCount, 1)
+	if ri.filter != nil {
+		ri.rows = make([]int, 0)
+	}
+	ri.la = ri.buf.LineArray
+	ri.version = ri.buf.version
+	ri.scan()
+}
+
+// Update brings the index up to date with the buffer
+func (ri *RowIndex) Update() {
+	if ri.la == ri.buf.LineArray && ri.version == ri.buf.version {
+		return
+	}
+	if ri.la != ri.buf.LineArray || ri.buf.NumLines < ri.scanned {
+		// The buffer was reloaded
+		ri.Rebuild()
+		return
+	}
+	if ri.filtering != nil {
+		// The new lines are checked once the scan is done
+		return
+	}
+
+	ri.generation++
+	ri.version = ri.buf.version
+	if ri.filter != nil && ri.scanned > 0 {
+		// The last line may have been completed by the new data
+		last := ri.scanned - 1
+		if n := len(ri.rows); n > 0 && ri.rows[n-1] == last {
+			ri.rows = ri.rows[:n-1]
+		}
+		ri.scanned = last
+	}
+	ri.scan()
+}
+
+// scan checks the lines which haven't been checked yet
+func (ri *RowIndex) scan() {
+	if ri.filter != nil && ri.la.index != nil && ri.scanned < ri.la.index.Len() {
+		ri.scanBackground()
+		return
+	}
+	if ri.filter != nil {
+		for i := ri.scanned; i < ri.buf.NumLines; i++ {
+			line := ri.buf.parseLine(i, ri.buf.fields)
+			if ri.filter(&line) {
+				ri.rows = append(ri.rows, i)
+			}
+		}
+	}
+	ri.scanned = ri.buf.NumLines
+}
+
+// scanBackground checks the lines which haven't been checked yet in the
+// background, reading the lines of the indexed file in batches. The rows
+// found are added by the jobs of the scan, which do nothing once it is
+// cancelled
+func (ri *RowIndex) scanBackground() {
+	snap := newLineSnapshot(ri.la)
+	scan := NewFilterScan(snap, ri.filter, &ri.scanCount)
+	start, end := ri.scanned, snap.Len()
+	ri.filtering = scan
+	ri.filtered = 0
+
+	go func() {
+		found := func(rows []int) bool {
+			jobs <- JobFunction{func(output string, args ...string) {
+				if !scan.Cancelled() {
+					ri.rows = append(ri.rows, rows...)
+					ri.generation++
+				}
+			}, "", nil}
+			return true
+		}
+		progress := func(scanned int) {
+			jobs <- JobFunction{func(output string, args ...string) {
+				if !scan.Cancelled() {
+					ri.filtered = scanned
+				}
+			}, "", nil}
+		}
+		if !scan.Run(rowRange{start: start, end: end}.chunks(), found, progress) {
+			return
+		}
+		jobs <- JobFunction{func(output string, args ...string) {
+			if scan.Cancelled() {
+				return
+			}
+			ri.filtering = nil
+			ri.scanned = end
+			ri.generation++
+			// Check the lines added during the scan
+			ri.Update()
+		}, "", nil}
+	}()
+}
+
+// Filtering returns whether lines are being checked in the background and
+// the fraction of them checked so far
+func (ri *RowIndex) Filtering() (bool, float64) {
+	if ri.filtering == nil {
+		return false, 1
+	}
+	total := ri.filtering.snap.Len() - ri.scanned
+	if total <= 0 {
+		return true, 1
+	}
+	return true, float64(ri.filtered) / float64(total)
+}
+
+// Len returns the number of rows
+func (ri *RowIndex) Len() int {
+	ri.Update()
+	if ri.filter == nil {
+		return ri.buf.NumLines
+	}
+	return len(ri.rows)
+}
+
+// Generation returns a number that changes whenever the rows may have
+// changed, by a new filter or lines added to the buffer
+func (ri *RowIndex) Generation() int {
+	ri.Update()
+	return ri.generation
+}
+
+// Rebuilds returns a number that changes whenever the index is rebuilt,
+// by a new filter or the buffer being reloaded
+func (ri *RowIndex) Rebuilds() int {
+	ri.Update()
+	return ri.rebuilds
+}
+
+// Line returns the buffer line shown at a row. Rows out of range give a
+// line past the end of the buffer, which is empty
+func (ri *RowIndex) Line(row int) int {
+	ri.Update()
+	if ri.filter == nil {
+		return row
+	}
+	if row < 0 || row >= len(ri.rows) {
+		return ri.buf.NumLines
+	}
+	return ri.rows[row]
+}
+
+// Row returns the row showing a buffer line. If the line is hidden the
+// row of the next line that is shown is returned
+func (ri *RowIndex) Row(line int) int {
+	ri.Update()
+	if ri.filter == nil {
+		return line
+	}
+	row := sort.SearchInts(ri.rows, line)
+	if row >= len(ri.rows) {
+		row = len(ri.rows) - 1
+	}
+	return Max(row, 0)
+}
+
+// A RowSnapshot holds the rows of a view as they were when it was taken,
+// for the searches running in the background. Once the fields of the
+// buffer are detected its lines are only replaced when data is appended to
+// the last one, so the snapshot shares the lines of the buffer and keeps
+// its own copy of the last one. Before that the fields of every line are
+// extracted again as lines come in, the snapshot copies the few lines
+// there are. The lines of an indexed file are read from the file again
+type RowSnapshot struct {
+	// The indexed file and how it was indexed
+	file    *os.File
+	offsets []int64
+	end     int64
+	indexed int
+	fields  *FieldMapping
+
+	// The lines in memory, after the indexed ones
+	lines []Line
+	last  Line
+
+	// The buffer lines of the rows, nil when every line is a row
+	rows     []int
+	numLines int
+}
+
+// NewRowSnapshot takes a snapshot of the rows of ri
+func NewRowSnapshot(ri *RowIndex) *RowSnapshot {
+	ri.Update()
+	s := newLineSnapshot(ri.buf.LineArray)
+	if ri.filter != nil {
+		s.rows = append([]int{}, ri.rows...)
+	}
+	return s
+}
+
+// newLineSnapshot takes a snapshot of the lines of la, every line is a row
+func newLineSnapshot(la *LineArray) *RowSnapshot {
+	s := &RowSnapshot{
+		lines:    la.lines,
+		fields:   la.fields,
+		numLines: la.Len(),
+	}
+	if la.index != nil {
+		s.file = la.index.file
+		s.offsets = la.index.offsets
+		s.end = la.index.end
+		s.indexed = la.index.Len()
+	}
+	if !la.fieldsDetected {
+		s.lines = append([]Line{}, la.lines...)
+	}
+	if n := len(s.lines); n > 0 {
+		s.last = s.lines[n-1]
+	}
+	return s
+}
+
+// Len returns the number of rows
+func (s *RowSnapshot) Len() int {
+	if s.rows == nil {
+		return s.numLines
+	}
+	return len(s.rows)
+}
+
+// BufLine returns the buffer line shown at a row
+func (s *RowSnapshot) BufLine(row int) int {
+	if s.rows == nil {
+		return row
+	}
+	return s.rows[row]
+}
+
+// Lines returns the lines shown at the rows from start up to end. Lines of
+// an indexed file are read together when they are close to each other and
+// they are only parsed if parse is true, otherwise only their data is set
+func (s *RowSnapshot) Lines(start, end int, parse bool) []*Line {
+	first, last := -1, -1
+	for row := start; row < end; row++ {
+		if n := s.BufLine(row); n < s.indexed {
+			if first < 0 {
+				first = n
+			}
+			last = n
+		}
+	}
+	var data [][]byte
+	if first >= 0 && last-first < 4*(end-start) {
+		data = readLines(s.file, s.offsets, s.end, first, last)
+	}
+
+	lines := make([]*Line, 0, end-start)
+	for row := start; row < end; row++ {
+		n := s.BufLine(row)
+		if n >= s.indexed {
+			n -= s.indexed
+			if n == len(s.lines)-1 {
+				lines = append(lines, &s.last)
+			} else {
+				lines = append(lines, &s.lines[n])
+			}
+			continue
+		}
+
+		var d []byte
+		if data != nil {
+			d = data[n-first]
+		} else {
+			d = readLine(s.file, s.offsets, s.end, n)
+		}
+		line := Line{data: d}
+		if parse {
+			line = NewLine(d, s.fields)
+		}
+		lines = append(lines, &line)
+	}
+	return lines
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The number of rows a worker checks at a time. Scans check whether they
+// were cancelled between chunks
+const scanChunkSize = 16 * 1024
+
+// How often a scan reports its progress
+const scanProgressInterval = 100 * time.Millisecond
+
+// A rowRange is the rows from start up to end, excluding end. The rows of
+// a reversed range are checked from the end
+type rowRange struct {
+	start, end int
+	reverse    bool
+}
+
+// chunks cuts the range into chunks, in the order they are scanned
+func (r rowRange) chunks() []rowRange {
+	var chunks []rowRange
+	for start := r.start; start < r.end; start += scanChunkSize {
+		chunks = append(chunks, rowRange{start, Min(start+scanChunkSize, r.end), r.reverse})
+	}
+	if r.reverse {
+		for i, j := 0, len(chunks)-1; i < j; i, j = i+1, j-1 {
+			chunks[i], chunks[j] = chunks[j], chunks[i]
+		}
+	}
+	return chunks
+}
+
+// A RowScan checks the rows of a snapshot against a search query or a
+// filter using all the CPUs. It is cancelled by changing the counter it was
+// started with
+type RowScan struct {
+	snap  *RowSnapshot
+	match func(line *Line) bool
+	// Whether the lines are parsed before they are checked
+	parse bool
+
+	counter *int64
+	id      int64
+}
+
+// NewRowScan returns a scan that is cancelled when counter is incremented
+func NewRowScan(snap *RowSnapshot, query *SearchQuery, counter *int64) *RowScan {
+	return &RowScan{snap, query.Match, !query.Raw(), counter, atomic.AddInt64(counter, 1)}
+}
+
+// NewFilterScan returns a scan checking the rows against a filter, it is
+// cancelled when counter is incremented
+func NewFilterScan(snap *RowSnapshot, filter func(line *Line) bool, counter *int64) *RowScan {
+	return &RowScan{snap, filter, true, counter, atomic.AddInt64(counter, 1)}
+}
+
+// Cancelled returns whether another scan was started with the same counter
+func (s *RowScan) Cancelled() bool {
+	return atomic.LoadInt64(s.counter) != s.id
+}
+
+// Run scans the chunks, as many at a time as there are CPUs. found is
+// called with the matching rows of each chunk, in the order of the chunks,
+// and stops the scan by returning false. progress, if not nil, is called
+// now and then with the number of rows scanned so far. Run returns false
+// if the scan was cancelled
+func (s *RowScan) Run(chunks []rowRange, found func(rows []int) bool, progress func(scanned int)) bool {
+	workers := runtime.NumCPU()
+	results := make([][]int, workers)
+	scanned := 0
+	lastProgress := time.Now()
+
+	for i := 0; i < len(chunks); i += workers {
+		if s.Cancelled() {
+			return false
+		}
+
+		wave := chunks[i:Min(i+workers, len(chunks))]
+		var wg sync.WaitGroup
+		for j, c := range wave {
+			wg.Add(1)
+			go func(j int, c rowRange) {
+				defer wg.Done()
+				results[j] = s.scanChunk(c)
+			}(j, c)
+		}
+		wg.Wait()
+
+		for j, c := range wave {
+			if len(results[j]) > 0 && !found(results[j]) {
+				return true
+			}
+			scanned += c.end - c.start
+		}
+		if progress != nil && time.Since(lastProgress) >= scanProgressInterval {
+			progress(scanned)
+			lastProgress = time.Now()
+		}
+	}
+	return true
+}
+
+// scanChunk returns the matching rows of a chunk, in the order they are
+// checked
+func (s *RowScan) scanChunk(c rowRange) []int {
+	var rows []int
+	lines := s.snap.Lines(c.start, c.end, s.parse)
+	if c.reverse {
+		for i := len(lines) - 1; i >= 0; i-- {
+			if s.match(lines[i]) {
+				rows = append(rows, c.start+i)
+			}
+		}
+		return rows
+	}
+	for i, line := range lines {
+		if s.match(line) {
+			rows = append(rows, c.start+i)
+		}
+	}
+	return rows
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"errors"
 	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
 
 	"github.com/zyedidia/tcell"
 )
 
 var (
-	// What was the last search
-	lastSearch string
-
 	// Where should we start the search down from (or up from)
 	searchStart int
 
@@ -20,6 +24,373 @@ var (
 	searchHistory []string
 )
 
+// A FindJob is a search for the next matching row running in the
+// background
+type FindJob struct {
+	// How many of the rows have been checked
+	scanned, total int
+}
+
+// A SearchQuery is what the search looks for: a regexp matched against the
+// raw lines or, when the search is scoped to a field as in level:error,
+// against the value of that field
+type SearchQuery struct {
+	re *regexp.Regexp
+	// The field the search is scoped to, empty for the whole line
+	field string
+
+	// Whether the text shown for the lines is searched instead of the raw
+	// lines, with the columns and time display mode it is shown with
+	display  bool
+	columns  []*Column
+	timeMode string
+}
+
+// A search for field:value, a leading backslash searches for the text as is
+var fieldSearchRegex = regexp.MustCompile(`^([A-Za-z_@][\w.@-]*):(.+)$`)
+
+// CompileSearch compiles the text typed in the search prompt according to
+// the search modes. With the searchregex option off the text is searched
+// literally and with the searchraw option off the text shown for the lines
+// is searched instead of their JSON. Case is ignored if the ignorecase
+// option of the buffer is on, unless the smartcase option is on and the
+// text has upper case letters
+func CompileSearch(searchStr string, v *View) (*SearchQuery, error) {
+	q := new(SearchQuery)
+	if !GetOption("searchraw").(bool) {
+		// The search may run in the background, it gets its own copy of
+		// what it needs to build the text of the lines
+		q.display = true
+		q.columns = append([]*Column{}, v.Buf.Columns()...)
+		q.timeMode = GetOption("time").(string)
+	}
+	expr := searchStr
+	if m := fieldSearchRegex.FindStringSubmatch(expr); m != nil {
+		q.field, expr = m[1], m[2]
+	} else if strings.HasPrefix(expr, `\`) && fieldSearchRegex.MatchString(expr[1:]) {
+		expr = expr[1:]
+	}
+
+	ignoreCase := v.Buf.Settings["ignorecase"].(bool)
+	if ignoreCase && GetOption("smartcase").(bool) {
+		ignoreCase = strings.IndexFunc(expr, unicode.IsUpper) < 0
+	}
+	if !GetOption("searchregex").(bool) {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err, ok := err.(*syntax.Error); ok {
+		// The expression in the error may have the (?i) we added
+		return nil, errors.New(err.Code.String())
+	} else if err != nil {
+		return nil, err
+	}
+	q.re = re
+	return q, nil
+}
+
+// Match returns whether a line matches the query
+func (q *SearchQuery) Match(line *Line) bool {
+	if q.field == "" && q.display {
+		return q.re.MatchString(displayText(line, q.columns, q.timeMode))
+	}
+	if q.field == "" {
+		return q.re.Match(line.data)
+	}
+	v, ok := fieldValue(line, q.field)
+	return ok && q.re.MatchString(valueToString(v))
+}
+
+// Raw returns whether the query only looks at the raw data of the lines
+func (q *SearchQuery) Raw() bool {
+	return q.field == "" && !q.display
+}
+
+// String returns the query in a form that tells queries apart
+func (q *SearchQuery) String() string {
+	str := q.re.String()
+	if q.field != "" {
+		str = q.field + ":" + str
+	}
+	if q.display {
+		str = "display " + q.timeMode + " " + str
+	}
+	return str
+}
+
+// displayText returns the text that is shown for a line: the values of the
+// columns followed by the whole message, with the JSON escapes resolved.
+// Lines that are not log entries are shown as they are
+func displayText(line *Line, cols []*Column, timeMode string) string {
+	if line.status != ParseOK {
+		return string(line.data)
+	}
+	texts := make([]string, 0, len(cols)+1)
+	for _, c := range cols {
+		texts = append(texts, c.Text(line, nil, timeMode))
+	}
+	texts = append(texts, line.entry.message)
+	return strings.Join(texts, columnSep)
+}
+
+// searchModes describes the search modes for the search prompt
+func searchModes(v *View) string {
+	modes := "regex"
+	if !GetOption("searchregex").(bool) {
+		modes = "literal"
+	}
+	if !GetOption("searchraw").(bool) {
+		modes += ", displayed text"
+	}
+	switch {
+	case !v.Buf.Settings["ignorecase"].(bool):
+		modes += ", match case"
+	case GetOption("smartcase").(bool):
+		modes += ", smart case"
+	default:
+		modes += ", ignore case"
+	}
+	return modes
+}
+
+// ToggleSearchRegex switches between regex and literal search
+func ToggleSearchRegex() {
+	OverrideOption("searchregex", strconv.FormatBool(!GetOption("searchregex").(bool)))
+}
+
+// ToggleSearchRaw switches between searching the raw lines and the text
+// shown for them
+func ToggleSearchRaw() {
+	OverrideOption("searchraw", strconv.FormatBool(!GetOption("searchraw").(bool)))
+}
+
+// CycleSearchCase switches between smart case, matching case and ignoring
+// case for the search in v
+func CycleSearchCase(v *View) {
+	switch {
+	case !v.Buf.Settings["ignorecase"].(bool):
+		v.setLocal("ignorecase", true)
+		OverrideOption("smartcase", "false")
+	case GetOption("smartcase").(bool):
+		v.setLocal("ignorecase", false)
+	default:
+		OverrideOption("smartcase", "true")
+	}
+}
+
+// SearchMatches holds the rows of a view that match its search. They are
+// counted in the background so that typing in the search prompt doesn't
+// wait for large buffers to be scanned
+type SearchMatches struct {
+	query *SearchQuery
+
+	// The row index the rows were counted in, its generation and how many
+	// times it was rebuilt. The count is started again when the index is
+	// rebuilt, only the new rows are counted when rows were appended
+	index      *RowIndex
+	generation int
+	rebuilds   int
+
+	// The matching rows, in order
+	rows     []int
+	counting bool
+	// Whether the rows appended since the count are being counted
+	updating bool
+	// How many of the rows have been counted so far, out of total
+	scanned, total int
+}
+
+// CountMatches highlights query in v and starts counting the rows matching
+// it. A count that is still running is cancelled
+func CountMatches(query *SearchQuery, v *View) {
+	snap := NewRowSnapshot(v.index)
+	scan := NewRowScan(snap, query, &v.matchCount)
+	v.matches = SearchMatches{
+		query:      query,
+		index:      v.index,
+		generation: v.index.Generation(),
+		rebuilds:   v.index.Rebuilds(),
+		counting:   true,
+		total:      snap.Len(),
+	}
+
+	go func() {
+		var rows []int
+		found := func(chunkRows []int) bool {
+			rows = append(rows, chunkRows...)
+			return true
+		}
+		progress := func(scanned int) {
+			jobs <- JobFunction{func(output string, args ...string) {
+				if !scan.Cancelled() {
+					v.matches.scanned = scanned
+				}
+			}, "", nil}
+		}
+		if !scan.Run(rowRange{0, snap.Len(), false}.chunks(), found, progress) {
+			return
+		}
+		jobs <- JobFunction{func(output string, args ...string) {
+			if !scan.Cancelled() {
+				v.matches.rows = rows
+				v.matches.counting = false
+			}
+		}, "", nil}
+	}()
+}
+
+// ClearMatches removes the highlighting from v and stops the count
+func ClearMatches(v *View) {
+	atomic.AddInt64(&v.matchCount, 1)
+	v.matches = SearchMatches{}
+}
+
+// UpdateMatches counts the matches of v again if its rows have changed.
+// When rows were only appended, as when following a file, only the new
+// rows are counted once the running count is done
+func UpdateMatches(v *View) {
+	m := &v.matches
+	if m.query == nil {
+		return
+	}
+	if m.index != v.index || m.rebuilds != v.index.Rebuilds() {
+		CountMatches(m.query, v)
+		return
+	}
+	if m.counting || m.updating || m.generation == v.index.Generation() {
+		return
+	}
+	countNewMatches(v)
+}
+
+// countNewMatches counts the matches in the rows appended to v since its
+// matches were counted. The last row counted is counted again, the data
+// appended may have completed its line
+func countNewMatches(v *View) {
+	snap := NewRowSnapshot(v.index)
+	scan := NewRowScan(snap, v.matches.query, &v.matchCount)
+	from, total := Max(v.matches.total-1, 0), snap.Len()
+	generation := v.index.Generation()
+	v.matches.updating = true
+
+	go func() {
+		var rows []int
+		found := func(chunkRows []int) bool {
+			rows = append(rows, chunkRows...)
+			return true
+		}
+		if !scan.Run(rowRange{from, total, false}.chunks(), found, nil) {
+			return
+		}
+		jobs <- JobFunction{func(output string, args ...string) {
+			if scan.Cancelled() {
+				return
+			}
+			m := &v.matches
+			kept := m.rows[:sort.SearchInts(m.rows, from)]
+			m.rows = append(kept[:len(kept):len(kept)], rows...)
+			m.generation = generation
+			m.total = total
+			m.updating = false
+		}, "", nil}
+	}()
+}
+
+// Status returns the text of the statusline about the matches in v, such
+// as "match 3/57"
+func (m *SearchMatches) Status(v *View) string {
+	if m.query == nil {
+		return ""
+	}
+	if m.counting {
+		return "counting matches " + percent(m.scanned, m.total)
+	}
+	i := sort.SearchInts(m.rows, v.Line)
+	if i < len(m.rows) && m.rows[i] == v.Line {
+		return "match " + strconv.Itoa(i+1) + "/" + strconv.Itoa(len(m.rows))
+	}
+	if len(m.rows) == 1 {
+		return "1 match"
+	}
+	return strconv.Itoa(len(m.rows)) + " matches"
+}
+
+// searchStatus returns the text of the statusline about the search in v
+func searchStatus(v *View) string {
+	if v.finding != nil {
+		return "searching " + percent(v.finding.scanned, v.finding.total)
+	}
+	return v.matches.Status(v)
+}
+
+// percent returns how much n is of total as a percentage
+func percent(n, total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return strconv.Itoa(n*100/total) + "%"
+}
+
+// CancelFind stops the search for the next match in v
+func CancelFind(v *View) {
+	atomic.AddInt64(&v.findCount, 1)
+	v.finding = nil
+}
+
+// Highlight returns which runes of str, the text shown for line, match the
+// search, nil if the line doesn't match. prev is the line above and cols
+// the columns str was formatted with. Only the lines that are counted as
+// matches are highlighted, so that the count and the highlighting agree.
+// A search scoped to a field is only highlighted in the column showing
+// that field. When the match is in a part of the line that isn't shown,
+// such as the keys of its JSON or a field that has no column, the whole
+// text, or the whole cell, is highlighted
+func (m *SearchMatches) Highlight(line, prev *Line, str string, cols []*Column) []bool {
+	if m.query == nil || !m.query.Match(line) {
+		return nil
+	}
+	runes := []rune(str)
+	matched := make([]bool, len(runes))
+	start, end := 0, len(runes)
+	if m.query.field != "" {
+		k := -1
+		for i, c := range cols {
+			if c.Path == m.query.field {
+				k = i
+				break
+			}
+		}
+		if k < 0 {
+			// No column shows the field
+			for i := range matched {
+				matched[i] = true
+			}
+			return matched
+		}
+		start, end = cellSpan(cols, k, line, prev)
+		end = Min(end, len(runes))
+	}
+
+	text := string(runes[Min(start, end):end])
+	locs := m.query.re.FindAllStringIndex(text, -1)
+	runeN := start
+	for i := range text {
+		matched[runeN] = locs == nil
+		for _, loc := range locs {
+			if i >= loc[0] && i < loc[1] {
+				matched[runeN] = true
+				break
+			}
+		}
+		runeN++
+	}
+	return matched
+}
+
 // BeginSearch starts a search
 func BeginSearch(searchStr string) {
 	searchHistory = append(searchHistory, "")
@@ -27,25 +398,27 @@ func BeginSearch(searchStr string) {
 	searching = true
 	messenger.response = searchStr
 	messenger.cursorx = Count(searchStr)
-	messenger.Message("Find: ")
+	messenger.Message("Find (" + searchModes(CurView()) + "): ")
 	messenger.hasPrompt = true
 }
 
 // EndSearch stops the current search
-func EndSearch() {
+func EndSearch(v *View) {
 	searchHistory[len(searchHistory)-1] = messenger.response
 	searching = false
 	messenger.hasPrompt = false
 	messenger.Clear()
 	messenger.Reset()
-	if lastSearch != "" {
+	if v.lastSearch != "" {
 		messenger.Message("N Previous n Next")
 	}
 }
 
 // ExitSearch exits the search mode, reset active search phrase, and clear status bar
 func ExitSearch(v *View) {
-	lastSearch = ""
+	v.lastSearch = ""
+	CancelFind(v)
+	ClearMatches(v)
 	searching = false
 	messenger.hasPrompt = false
 	messenger.Clear()
@@ -64,8 +437,26 @@ func HandleSearchEvent(event tcell.Event, v *View) {
 			return
 		case tcell.KeyCtrlQ, tcell.KeyCtrlC, tcell.KeyEnter:
 			// Done
-			EndSearch()
+			EndSearch(v)
 			return
+		case tcell.KeyRune:
+			// Alt-r, Alt-c and Alt-t change the search modes
+			if e.Modifiers()&tcell.ModAlt != 0 && strings.ContainsRune("rct", e.Rune()) {
+				switch e.Rune() {
+				case 'r':
+					ToggleSearchRegex()
+				case 'c':
+					CycleSearchCase(v)
+				case 't':
+					ToggleSearchRaw()
+				}
+				messenger.message = "Find (" + searchModes(v) + "): "
+				if messenger.response != "" {
+					Search(messenger.response, v, true)
+					v.Relocate()
+				}
+				return
+			}
 		}
 	}
 
@@ -73,13 +464,15 @@ func HandleSearchEvent(event tcell.Event, v *View) {
 
 	if messenger.cursorx < 0 {
 		// Done
-		EndSearch()
+		EndSearch(v)
 		return
 	}
 
 	if messenger.response == "" {
-		// v.Cursor.ResetSelection()
 		// We don't end the search though
+		messenger.promptError = ""
+		CancelFind(v)
+		ClearMatches(v)
 		return
 	}
 
@@ -90,74 +483,72 @@ func HandleSearchEvent(event tcell.Event, v *View) {
 	return
 }
 
-func searchDown(r *regexp.Regexp, v *View, startY, endY int) bool {
-	for i := startY; i <= endY; i++ {
-		var l []byte
-		if i == startY {
-			runes := []rune(string(v.Buf.lines[i].data))
-			l = []byte(string(runes[0:]))
-		} else {
-			l = v.Buf.lines[i].data
-		}
-
-		match := r.FindIndex(l)
-
-		if match != nil {
-			v.Line = i
-			return true
-		}
-	}
-	return false
-}
-
-func searchUp(r *regexp.Regexp, v *View, startY, endY int) bool {
-	for i := startY; i >= endY; i-- {
-		var l []byte
-		if i == startY {
-			runes := []rune(string(v.Buf.lines[i].data))
-			l = []byte(string(runes[:0]))
-		} else {
-			l = v.Buf.lines[i].data
-		}
-
-		match := r.FindIndex(l)
-
-		if match != nil {
-			v.Line = i
-			return true
-		}
-	}
-	return false
-}
-
-// Search searches in the view for the given regex. The down bool
-// specifies whether it should search down from the searchStart position
-// or up from there
+// Search starts searching in the view for the given text in the
+// background, the cursor moves to the first match that is found. The down
+// bool specifies whether it should search down from the searchStart
+// position or up from there. A search that is still running is cancelled
 func Search(searchStr string, v *View, down bool) {
 	if searchStr == "" {
 		return
 	}
-	// r, err := regexp.Compile(searchStr)
-	// if v.Buf.Settings["ignorecase"].(bool) {
-	r, err := regexp.Compile("(?i)" + searchStr)
-	// }
+	q, err := CompileSearch(searchStr, v)
+	if searching {
+		messenger.promptError = ""
+	}
 	if err != nil {
+		CancelFind(v)
+		if searching {
+			// Shown next to what is being typed
+			messenger.promptError = err.Error()
+		} else {
+			messenger.Error(err.Error())
+		}
 		return
 	}
+	if v.matches.query == nil || v.matches.query.String() != q.String() {
+		CountMatches(q, v)
+	}
 
-	var found bool
+	// The rows are checked in the order they are searched, wrapping
+	// around the end
+	snap := NewRowSnapshot(v.index)
+	n := snap.Len()
+	start := Max(Min(searchStart, n), 0)
+	var chunks []rowRange
 	if down {
-		found = searchDown(r, v, searchStart, v.Buf.End())
-		if !found {
-			found = searchDown(r, v, v.Buf.Start(), searchStart)
-		}
+		chunks = append(rowRange{start, n, false}.chunks(), rowRange{0, start, false}.chunks()...)
 	} else {
-		found = searchUp(r, v, searchStart, v.Buf.Start())
-		if !found {
-			found = searchUp(r, v, v.Buf.End(), searchStart)
-		}
-	}
-	if found {
-		lastSearch = searchStr
+		chunks = append(rowRange{0, start, true}.chunks(), rowRange{Min(start+1, n), n, true}.chunks()...)
 	}
+
+	scan := NewRowScan(snap, q, &v.findCount)
+	job := &FindJob{total: n}
+	v.finding = job
+	go func() {
+		row := -1
+		found := func(rows []int) bool {
+			row = rows[0]
+			return false
+		}
+		progress := func(scanned int) {
+			jobs <- JobFunction{func(output string, args ...string) {
+				job.scanned = scanned
+			}, "", nil}
+		}
+		if !scan.Run(chunks, found, progress) {
+			return
+		}
+		jobs <- JobFunction{func(output string, args ...string) {
+			if scan.Cancelled() {
+				return
+			}
+			v.finding = nil
+			if row >= 0 {
+				// The rows may have changed since the search started
+				v.Line = v.RowOf(snap.BufLine(row))
+				v.lastSearch = searchStr
+				v.Relocate()
+			}
+		}, "", nil}
+	}()
 }
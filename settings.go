@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flynn/json5"
+)
+
+type optionValidator func(string, interface{}) error
+
+// The validators check the values of options beyond their type
+var optionValidators = map[string]optionValidator{
+	"colorscheme":  validateColorscheme,
+	"time":         validateTimeDisplay,
+	"level":        validateLevel,
+	"scrollmargin": validateNonNegativeValue,
+}
+
+// The global settings, from the defaults, settings.json and the set command
+var globalSettings map[string]interface{}
+
+// The global options set for this session only, by the command line flags
+// and the search mode toggles. They take precedence over globalSettings and
+// are never written to settings.json
+var sessionSettings map[string]interface{}
+
+// The global options read from settings.json or set with the set command,
+// the only ones written back to settings.json
+var savedOptions map[string]bool
+
+// The settings of settings.json for the files matching a glob, such as
+// "*.access.log": {"ignorecase": false}
+var localSettings map[string]map[string]interface{}
+
+// DefaultGlobalSettings returns the default global settings for jv
+// Note that colorscheme is a global only option
+func DefaultGlobalSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"colorscheme":  "default",
+		"time":         "utc",
+		"level":        "",
+		"delta":        false,
+		"infobar":      true,
+		"termtitle":    true,
+		"scrollmargin": float64(3),
+		"searchraw":    true,
+		"searchregex":  true,
+		"smartcase":    true,
+		"splitbottom":  true,
+		"splitright":   true,
+
+		"ignorecase": true,
+		"softwrap":   false,
+		"statusline": true,
+	}
+}
+
+// DefaultLocalSettings returns the default local settings, which can be
+// set for each buffer
+func DefaultLocalSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"ignorecase": true,
+		"softwrap":   false,
+		"statusline": true,
+	}
+}
+
+// InitGlobalSettings initializes the options map and sets all options to
+// their default values, then reads settings.json over them. The problems
+// found in settings.json are returned so they can be shown once the
+// messenger is up
+func InitGlobalSettings() []error {
+	globalSettings = DefaultGlobalSettings()
+	sessionSettings = make(map[string]interface{})
+	savedOptions = make(map[string]bool)
+	localSettings = make(map[string]map[string]interface{})
+
+	filename := filepath.Join(configDir, "settings.json")
+	input, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return []error{errors.New("Error reading settings.json file: " + err.Error())}
+	}
+
+	var parsed map[string]interface{}
+	if err := json5.Unmarshal(input, &parsed); err != nil {
+		return []error{errors.New("Error reading settings.json: " + err.Error())}
+	}
+
+	var errs []error
+	for _, k := range sortedKeys(parsed) {
+		v := parsed[k]
+		if local, ok := v.(map[string]interface{}); ok {
+			// Settings for the files matching a glob
+			if _, err := filepath.Match(k, ""); err != nil {
+				errs = append(errs, errors.New("Invalid glob in settings.json: "+k))
+				continue
+			}
+			localSettings[k] = make(map[string]interface{})
+			for _, option := range sortedKeys(local) {
+				if err := checkOption(option, local[option], true); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				localSettings[k][option] = local[option]
+			}
+			continue
+		}
+		if err := checkOption(k, v, false); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		globalSettings[k] = v
+		savedOptions[k] = true
+	}
+	return errs
+}
+
+// InitLocalSettings sets the local settings of a buffer from the global
+// settings and the settings of the globs in settings.json matching its path
+func InitLocalSettings(buf *Buffer) {
+	buf.Settings = DefaultLocalSettings()
+	for k := range buf.Settings {
+		if v := GetOption(k); v != nil {
+			buf.Settings[k] = v
+		}
+	}
+
+	for _, glob := range sortedLocalGlobs() {
+		if !globMatches(glob, buf.Path) {
+			continue
+		}
+		for k, v := range localSettings[glob] {
+			buf.Settings[k] = v
+		}
+	}
+}
+
+// globMatches returns whether a glob matches a path, or its base name for
+// globs without a directory
+func globMatches(glob, path string) bool {
+	if path == "" {
+		return false
+	}
+	if ok, _ := filepath.Match(glob, path); ok {
+		return true
+	}
+	if !strings.ContainsRune(glob, filepath.Separator) {
+		ok, _ := filepath.Match(glob, filepath.Base(path))
+		return ok
+	}
+	return false
+}
+
+// WriteSettings writes the global options that were read from
+// settings.json or set with the set command to settings.json, along with
+// the settings for globs
+func WriteSettings() error {
+	parsed := make(map[string]interface{})
+	for k := range savedOptions {
+		parsed[k] = globalSettings[k]
+	}
+	for glob, settings := range localSettings {
+		parsed[glob] = settings
+	}
+
+	txt, err := json.MarshalIndent(parsed, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(configDir, os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(configDir, "settings.json"), append(txt, '\n'), 0644)
+}
+
+// GetOption returns the value of a global option
+func GetOption(option string) interface{} {
+	if v, ok := sessionSettings[option]; ok {
+		return v
+	}
+	return globalSettings[option]
+}
+
+// checkOption checks that an option exists, that value has the type of the
+// option and that the option's validator accepts it
+func checkOption(option string, value interface{}, local bool) error {
+	def, ok := DefaultGlobalSettings()[option]
+	if !ok {
+		return errors.New("Unknown option " + option)
+	}
+	if local {
+		if _, ok := DefaultLocalSettings()[option]; !ok {
+			return errors.New(option + " is a global option")
+		}
+	}
+	if reflect.TypeOf(value) != reflect.TypeOf(def) {
+		return errors.New("Invalid value for " + option + ": " + reflect.TypeOf(def).String() + " expected")
+	}
+	if validator, ok := optionValidators[option]; ok {
+		return validator(option, value)
+	}
+	return nil
+}
+
+// parseOptionValue converts the text of a value to the type of an option
+func parseOptionValue(option, value string) (interface{}, error) {
+	def, ok := DefaultGlobalSettings()[option]
+	if !ok {
+		return nil, errors.New("Unknown option " + option)
+	}
+
+	var nativeValue interface{}
+	switch def.(type) {
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("Invalid value for " + option + ": true or false expected")
+		}
+		nativeValue = b
+	case float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, errors.New("Invalid value for " + option + ": number expected")
+		}
+		nativeValue = f
+	default:
+		nativeValue = value
+	}
+
+	if validator, ok := optionValidators[option]; ok {
+		if err := validator(option, nativeValue); err != nil {
+			return nil, err
+		}
+	}
+	return nativeValue, nil
+}
+
+// OverrideOption sets a global option for this session only, as the
+// command line flags do. The override is not written to settings.json
+func OverrideOption(option, value string) error {
+	nativeValue, err := parseOptionValue(option, value)
+	if err != nil {
+		return err
+	}
+	sessionSettings[option] = nativeValue
+	return nil
+}
+
+// SetOption attempts to set the given option to the value
+// By default it will set the option as global, but if the option
+// is local only it will set the local version
+// Use setlocal to force an option to be set locally
+func SetOption(option, value string) error {
+	nativeValue, err := parseOptionValue(option, value)
+	if err != nil {
+		return err
+	}
+	globalSettings[option] = nativeValue
+	// The option set explicitly replaces the one of the command line
+	delete(sessionSettings, option)
+
+	if option == "colorscheme" {
+		if err := LoadColorscheme(value); err != nil {
+			return err
+		}
+	}
+	if option == "delta" && nativeValue.(bool) != hasDeltaColumn() {
+		toggleDeltaColumn()
+	}
+
+	for _, v := range allViews() {
+		if option == "level" {
+			l, _ := ParseLevelInput(value)
+			v.SetMinLevel(l)
+		}
+		if _, ok := v.Buf.Settings[option]; ok {
+			v.setLocal(option, nativeValue)
+		}
+	}
+	return nil
+}
+
+// SetLocalOption sets the local version of this option
+func SetLocalOption(option, value string, view *View) error {
+	if _, ok := view.Buf.Settings[option]; !ok {
+		if _, ok := globalSettings[option]; ok {
+			return errors.New(option + " is a global option")
+		}
+		return errors.New("Unknown option " + option)
+	}
+	nativeValue, err := parseOptionValue(option, value)
+	if err != nil {
+		return err
+	}
+	view.setLocal(option, nativeValue)
+	return nil
+}
+
+// setLocal changes a local option of the view's buffer and applies it
+func (v *View) setLocal(option string, value interface{}) {
+	old := v.Buf.Settings[option]
+	v.Buf.Settings[option] = value
+
+	if option == "statusline" && old != value {
+		v.ToggleStatusLine()
+	}
+	if option == "softwrap" && value.(bool) {
+		v.leftCol = 0
+	}
+}
+
+// SetOptionAndSettings sets the given option and saves the option setting
+// to the settings config file
+func SetOptionAndSettings(option, value string) bool {
+	if err := SetOption(option, value); err != nil {
+		messenger.Error(err.Error())
+		return false
+	}
+	savedOptions[option] = true
+	if err := WriteSettings(); err != nil {
+		messenger.Error("Error writing to settings.json: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// OptionNames returns the names of all the options
+func OptionNames() []string {
+	return sortedKeys(globalSettings)
+}
+
+// OptionValues returns the values an option can take when there are few
+func OptionValues(option string) []string {
+	switch option {
+	case "colorscheme":
+		return ColorschemeNames()
+	case "time":
+		return timeDisplayModes
+	case "level":
+		return levelNames[1:]
+	}
+	if _, ok := GetOption(option).(bool); ok {
+		return []string{"true", "false"}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedLocalGlobs() []string {
+	globs := make([]string, 0, len(localSettings))
+	for glob := range localSettings {
+		globs = append(globs, glob)
+	}
+	sort.Strings(globs)
+	return globs
+}
+
+func validateNonNegativeValue(option string, value interface{}) error {
+	if value.(float64) < 0 {
+		return errors.New(option + " must be non-negative")
+	}
+	return nil
+}
+
+func validateColorscheme(option string, value interface{}) error {
+	if !ColorschemeExists(value.(string)) {
+		return errors.New(value.(string) + " is not a valid colorscheme")
+	}
+	return nil
+}
+
+func validateTimeDisplay(option string, value interface{}) error {
+	if !validTimeDisplay(value.(string)) {
+		return errors.New(option + " must be one of " + strings.Join(timeDisplayModes, ", "))
+	}
+	return nil
+}
+
+func validateLevel(option string, value interface{}) error {
+	if _, ok := ParseLevelInput(value.(string)); !ok {
+		return errors.New("Unknown level " + value.(string))
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+// SplitType tells how the children of a split share its space
+type SplitType uint8
+
+const (
+	// VerticalSplit puts the children side by side
+	VerticalSplit SplitType = iota
+	// HorizontalSplit stacks the children
+	HorizontalSplit
+)
+
+// A Node is a view or a split in the split tree of a tab
+type Node interface {
+	// Layout places the node on the screen, the height includes the
+	// statuslines of the views
+	Layout(x, y, width, height int)
+	// Views returns the views of the node from left to right and top to
+	// bottom
+	Views() []*View
+
+	setParent(parent *SplitTree)
+}
+
+// A LeafNode holds one of the views of a tab
+type LeafNode struct {
+	view   *View
+	parent *SplitTree
+}
+
+// NewLeafNode returns a leaf holding v in the split parent
+func NewLeafNode(v *View, parent *SplitTree) *LeafNode {
+	n := new(LeafNode)
+	n.view = v
+	n.view.splitNode = n
+	n.parent = parent
+	return n
+}
+
+// A SplitTree divides its space evenly between its children, which are
+// views or other splits going the other way
+type SplitTree struct {
+	kind     SplitType
+	parent   *SplitTree
+	children []Node
+}
+
+// NewSplitTree returns the split tree of a tab showing only v
+func NewSplitTree(v *View) *SplitTree {
+	s := new(SplitTree)
+	s.children = []Node{NewLeafNode(v, s)}
+	return s
+}
+
+// Layout places the view of the leaf
+func (l *LeafNode) Layout(x, y, width, height int) {
+	l.view.SetLayout(x, y, width, height)
+}
+
+// Views returns the view of the leaf
+func (l *LeafNode) Views() []*View {
+	return []*View{l.view}
+}
+
+func (l *LeafNode) setParent(parent *SplitTree) {
+	l.parent = parent
+}
+
+// Split puts a new view on buf next to the leaf and returns it. The view
+// goes at splitIndex among the views split the same way as it, which are
+// the leaf and the new view alone if the leaf was split the other way
+func (l *LeafNode) Split(kind SplitType, buf *Buffer, splitIndex int) *View {
+	v := NewView(buf)
+	p := l.parent
+	if p.kind == kind || len(p.children) == 1 {
+		// The view joins the views already split this way
+		p.kind = kind
+		p.insert(Max(Min(splitIndex, len(p.children)), 0), NewLeafNode(v, p))
+		return v
+	}
+
+	// The leaf is split the other way, it is replaced by a new split
+	s := &SplitTree{kind: kind, parent: p}
+	p.children[p.index(l)] = s
+	l.parent = s
+	s.children = []Node{l}
+	s.insert(Max(Min(splitIndex, 1), 0), NewLeafNode(v, s))
+	return v
+}
+
+// Position returns the index of the leaf among the views split the given
+// way, it is 0 if the leaf is split the other way
+func (l *LeafNode) Position(kind SplitType) int {
+	if l.parent.kind == kind || len(l.parent.children) == 1 {
+		return l.parent.index(l)
+	}
+	return 0
+}
+
+// Delete removes the leaf from the tree. A split that is left with a
+// single child is replaced by that child
+func (l *LeafNode) Delete() {
+	p := l.parent
+	i := p.index(l)
+	p.children = append(p.children[:i], p.children[i+1:]...)
+	l.view.splitNode = nil
+
+	if len(p.children) != 1 {
+		return
+	}
+	child, gp := p.children[0], p.parent
+	if gp == nil {
+		if s, ok := child.(*SplitTree); ok {
+			// The root takes over the only split left in it
+			p.kind, p.children = s.kind, s.children
+			for _, c := range p.children {
+				c.setParent(p)
+			}
+		}
+		return
+	}
+	if s, ok := child.(*SplitTree); ok && s.kind == gp.kind {
+		// The split goes the same way as the one above, its children
+		// join it
+		j := gp.index(p)
+		gp.children = append(gp.children[:j], append(s.children, gp.children[j+1:]...)...)
+		for _, c := range s.children {
+			c.setParent(gp)
+		}
+		return
+	}
+	gp.children[gp.index(p)] = child
+	child.setParent(gp)
+}
+
+// Layout shares the space of the split between its children
+func (s *SplitTree) Layout(x, y, width, height int) {
+	n := len(s.children)
+	for i, c := range s.children {
+		if s.kind == VerticalSplit {
+			// The cells left over by the division are spread out
+			start, end := width*i/n, width*(i+1)/n
+			c.Layout(x+start, y, end-start, height)
+		} else {
+			start, end := height*i/n, height*(i+1)/n
+			c.Layout(x, y+start, width, end-start)
+		}
+	}
+}
+
+// Views returns the views of every leaf under the split, in order
+func (s *SplitTree) Views() []*View {
+	var views []*View
+	for _, c := range s.children {
+		views = append(views, c.Views()...)
+	}
+	return views
+}
+
+func (s *SplitTree) setParent(parent *SplitTree) {
+	s.parent = parent
+}
+
+// index returns the position of a child of the split
+func (s *SplitTree) index(child Node) int {
+	for i, c := range s.children {
+		if c == child {
+			return i
+		}
+	}
+	return -1
+}
+
+// insert adds a child to the split at position i
+func (s *SplitTree) insert(i int, child Node) {
+	s.children = append(s.children, nil)
+	copy(s.children[i+1:], s.children[i:])
+	s.children[i] = child
+}
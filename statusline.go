@@ -2,6 +2,7 @@ package main
 
 import (
 	"strconv"
+	"strings"
 )
 
 // Statusline represents the information line at the bottom
@@ -28,9 +29,46 @@ func (sline *Statusline) Display() {
 	// but users will be used to (1,1) (first line,first column)
 	// We use GetVisualX() here because otherwise we get the column number in runes
 	// so a '\t' is only 1, when it should be tabSize
-	lineNum := strconv.Itoa(sline.view.Line + 1)
+	v := sline.view
+	lineNum := strconv.Itoa(v.BufLine(v.Line) + 1)
+	numLines := strconv.Itoa(v.Buf.NumLines)
 
-	file += " (" + lineNum + ")"
+	if v.Filtered() {
+		// Show where we are among the lines that pass the filter as well
+		file += " (" + lineNum + ") " + strconv.Itoa(v.Line+1) + "/" + strconv.Itoa(v.NumRows()) + " of " + numLines
+	} else {
+		file += " (" + lineNum + "/" + numLines + ")"
+	}
+	if v.minLevel != LevelUnknown {
+		file += " [" + v.minLevel.String() + "+]"
+	}
+	if v.filter != nil {
+		file += " [filter: " + v.filter.String() + "]"
+	}
+	if len(v.hiddenSources) > 0 {
+		file += " [sources: " + strings.Join(v.ShownSources(), ", ") + "]"
+	}
+	if v.HasTimeWindow() {
+		file += " [" + formatTimeWindow(v.since, v.until) + "]"
+	}
+
+	if status := searchStatus(v); status != "" {
+		file += " [" + status + "]"
+	}
+
+	if indexing, progress := v.Buf.Indexing(); indexing {
+		file += " [indexing " + strconv.Itoa(int(progress*100)) + "%]"
+	}
+	if filtering, progress := v.index.Filtering(); filtering {
+		file += " [filtering " + strconv.Itoa(int(progress*100)) + "%]"
+	}
+	if v.summarizing != nil {
+		file += " [parse summary " + percent(v.summarizing.scanned, v.summarizing.total) + "]"
+	}
+
+	if sline.view.Buf.follower != nil {
+		file += " [follow]"
+	}
 
 	// file += " " + sline.view.Buf.Settings["fileformat"].(string)
 
@@ -42,23 +80,23 @@ func (sline *Statusline) Display() {
 		}
 	}
 
-	statusLineStyle := defStyle.Reverse(true)
-	// if style, ok := colorscheme["statusline"]; ok {
-	// 	statusLineStyle = style
-	// }
+	statusLineStyle := GetColor("statusline")
 
 	// Maybe there is a unicode filename?
 	fileRunes := []rune(file)
 	viewX := sline.view.x
+	width := sline.view.Width
 	if viewX != 0 {
+		// The divider of the view takes the first column
 		screen.SetContent(viewX, y, ' ', nil, statusLineStyle)
 		viewX++
+		width--
 	}
-	for x := 0; x < sline.view.Width; x++ {
+	for x := 0; x < width; x++ {
 		if x < len(fileRunes) {
 			screen.SetContent(viewX+x, y, fileRunes[x], nil, statusLineStyle)
-		} else if x >= sline.view.Width-len(rightText) && x < len(rightText)+sline.view.Width-len(rightText) {
-			screen.SetContent(viewX+x, y, []rune(rightText)[x-sline.view.Width+len(rightText)], nil, statusLineStyle)
+		} else if x >= width-len(rightText) && x < width {
+			screen.SetContent(viewX+x, y, []rune(rightText)[x-width+len(rightText)], nil, statusLineStyle)
 		} else {
 			screen.SetContent(viewX+x, y, ' ', nil, statusLineStyle)
 		}
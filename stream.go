@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+)
+
+// The size of the chunks read from a stream
+const streamChunkSize = 64 * 1024
+
+// StreamInput reads r in the background until it is exhausted, appending
+// everything to buf as it arrives. This is used for pipes such as
+// `kubectl logs -f pod | jv` where the input never has a known size.
+// Compressed input is decompressed as it arrives
+func StreamInput(buf *Buffer, r io.Reader) {
+	go func() {
+		r, _, err := Decompress(r)
+		if err != nil {
+			jobs <- JobFunction{func(output string, args ...string) {
+				messenger.Error("Error reading ", buf.GetName(), ": ", output)
+			}, err.Error(), nil}
+			return
+		}
+
+		chunk := make([]byte, streamChunkSize)
+		for {
+			n, err := r.Read(chunk)
+			if n > 0 {
+				jobs <- JobFunction{func(output string, args ...string) {
+					appendAndPin(buf, []byte(output))
+				}, string(chunk[:n]), nil}
+			}
+			if err != nil {
+				if err != io.EOF {
+					jobs <- JobFunction{func(output string, args ...string) {
+						messenger.Error("Error reading ", buf.GetName(), ": ", output)
+					}, err.Error(), nil}
+				}
+				return
+			}
+		}
+	}()
+}
+
+// appendAndPin appends data to buf. This must run on the UI goroutine.
+// The views of buf whose cursor was on the last line stay pinned to the
+// bottom
+func appendAndPin(buf *Buffer, data []byte) {
+	var pinned []*View
+	for _, v := range allViews() {
+		if v.Buf == buf && v.Line >= v.NumRows()-1 {
+			pinned = append(pinned, v)
+		}
+	}
+
+	buf.Append(data)
+
+	for _, v := range pinned {
+		v.End()
+		v.Relocate()
+	}
+}
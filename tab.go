@@ -0,0 +1,234 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// The open tabs and the index of the one that is shown
+var (
+	tabs   []*Tab
+	curTab int
+)
+
+// A Tab holds the views of one of the open logs. Each view keeps its own
+// cursor, filters and search, switching tabs leaves them as they were.
+// The views of a tab are laid out by its split tree
+type Tab struct {
+	// This contains all the views in this tab
+	// There is generally only one view per tab, but you can have
+	// multiple views with splits
+	Views []*View
+	// This is the current view for this tab
+	CurView int
+
+	tree *SplitTree
+	num  int
+}
+
+// NewTabFromView creates a new tab and puts the given view in the tab
+func NewTabFromView(v *View) *Tab {
+	t := new(Tab)
+	t.Views = append(t.Views, v)
+	t.Views[0].Num = 0
+	t.tree = NewSplitTree(v)
+	return t
+}
+
+// Resize lays the views of the tab out between the tabbar and the
+// messenger
+func (t *Tab) Resize() {
+	w, h := screen.Size()
+	y := 0
+	if len(tabs) > 1 {
+		y = 1
+	}
+	// The messenger takes the last row of the screen
+	t.tree.Layout(0, y, w, Max(h-y-1, 0))
+}
+
+// Update takes the views from the split tree after it changed and lays
+// them out again. cur becomes the current view
+func (t *Tab) Update(cur *View) {
+	t.Views = t.tree.Views()
+	for i, v := range t.Views {
+		v.Num = i
+		v.TabNum = t.num
+		if v == cur {
+			t.CurView = i
+		}
+	}
+	t.Resize()
+}
+
+// CloseView removes a view from the tab, the view that took its place
+// becomes the current one
+func (t *Tab) CloseView(v *View) {
+	v.splitNode.Delete()
+	cur := t.Views[Max(v.Num-1, 0)]
+	if cur == v {
+		cur = t.Views[1]
+	}
+	t.Update(cur)
+}
+
+// SetNum sets all this tab's views to have the correct tab number
+func (t *Tab) SetNum(num int) {
+	t.num = num
+	for _, v := range t.Views {
+		v.TabNum = num
+	}
+}
+
+// Display draws the views of the tab
+func (t *Tab) Display() {
+	for _, v := range t.Views {
+		v.Display()
+	}
+}
+
+// AddTab opens a new tab showing buf and switches to it
+func AddTab(buf *Buffer) *View {
+	v := NewView(buf)
+	tab := NewTabFromView(v)
+	tab.SetNum(len(tabs))
+	tabs = append(tabs, tab)
+	curTab = len(tabs) - 1
+	if len(tabs) == 2 {
+		// The tabbar appears above every view
+		ResizeAll()
+	} else {
+		tab.Resize()
+	}
+	return v
+}
+
+// CloseTab closes the tab at index i. The last tab can't be closed
+func CloseTab(i int) {
+	closed := tabs[i]
+	tabs = append(tabs[:i], tabs[i+1:]...)
+	for _, v := range closed.Views {
+		CancelFind(v)
+		ClearMatches(v)
+		v.CloseBuffer()
+	}
+	for j, t := range tabs {
+		t.SetNum(j)
+	}
+	if curTab >= len(tabs) || curTab > i {
+		curTab--
+	}
+	if len(tabs) == 1 {
+		ResizeAll()
+	}
+}
+
+// OpenTab opens files in a new tab. Several files, or glob patterns
+// matching several, are merged into one buffer
+func OpenTab(args []string) bool {
+	buf := openFiles(args)
+	if buf == nil {
+		return false
+	}
+	AddTab(buf)
+	return true
+}
+
+// openFiles loads the files given as arguments into a buffer, merging them
+// if there are several. It returns nil if none could be read
+func openFiles(args []string) *Buffer {
+	for i, arg := range args {
+		args[i] = ReplaceHome(arg)
+	}
+	files := ExpandGlobs(args)
+	if len(files) == 1 {
+		return LoadFile(files[0])
+	}
+
+	buf, errs := NewMergedBuffer(files)
+	reportErrors(errs)
+	if len(buf.Sources) == 0 {
+		// None of the files could be read
+		return nil
+	}
+	return buf
+}
+
+// SwitchTab shows the tab at index i, wrapping around at both ends
+func SwitchTab(i int) {
+	curTab = (i + len(tabs)) % len(tabs)
+}
+
+// CurView returns the current view
+func CurView() *View {
+	t := tabs[curTab]
+	return t.Views[t.CurView]
+}
+
+// allViews returns every open view
+func allViews() []*View {
+	var views []*View
+	for _, t := range tabs {
+		views = append(views, t.Views...)
+	}
+	return views
+}
+
+// TabbarString returns the string that should be displayed in the tabbar
+// along with where the current tab starts and ends in it
+func TabbarString() (string, int, int) {
+	str := ""
+	start, end := 0, 0
+	unique := make(map[string]int)
+
+	for _, t := range tabs {
+		unique[filepath.Base(t.Views[t.CurView].Buf.GetName())]++
+	}
+
+	for i, t := range tabs {
+		buf := t.Views[t.CurView].Buf
+		name := filepath.Base(buf.GetName())
+		if unique[name] > 1 {
+			name = buf.GetName()
+		}
+
+		if i == curTab {
+			start = Count(str)
+			str += "[" + name + "]"
+			end = Count(str)
+		} else {
+			str += " " + name + " "
+		}
+		str += " "
+	}
+	return str, start, end
+}
+
+// DisplayTabs displays the tabbar at the top of the screen if there are
+// multiple tabs
+func DisplayTabs() {
+	if len(tabs) <= 1 {
+		return
+	}
+
+	str, start, end := TabbarString()
+	tabBarStyle := GetColor("tabbar")
+	fileRunes := []rune(str)
+	w, _ := screen.Size()
+
+	// When the tabs don't fit the current one is kept in view
+	offset := 0
+	if end > w {
+		offset = Min(end-w+1, start)
+	}
+	for x := 0; x < w; x++ {
+		r := ' '
+		if x+offset < len(fileRunes) {
+			r = fileRunes[x+offset]
+		}
+		style := tabBarStyle
+		if x+offset >= start && x+offset < end {
+			style = GetColor("tabbar.current")
+		}
+		screen.SetContent(x, 0, r, nil, style)
+	}
+}
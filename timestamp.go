@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The layouts tried, in order, when parsing a timestamp. Timestamps
+// without a time zone are taken as UTC. Layouts from fields.json and the
+// -time-layout flag are tried before these
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05.999999999",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RubyDate,
+	time.UnixDate,
+	time.ANSIC,
+}
+
+// parseTimestamp parses a timestamp in one of the known layouts or as a
+// number of seconds, milliseconds, microseconds or nanoseconds since the
+// epoch
+func parseTimestamp(str string) (time.Time, bool) {
+	return parseTimeValue(str, timestampLayouts)
+}
+
+// parseTimeValue parses the value of a timestamp field, trying layouts in
+// order for strings. Numbers, and strings which only hold a number, are
+// times since the epoch
+func parseTimeValue(v interface{}, layouts []string) (time.Time, bool) {
+	var str string
+	switch v := v.(type) {
+	case json.Number:
+		return parseEpoch(v.String())
+	case float64:
+		return parseEpoch(strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		str = strings.TrimSpace(v)
+	default:
+		return time.Time{}, false
+	}
+
+	if str == "" {
+		return time.Time{}, false
+	}
+	if isEpoch(str) {
+		return parseEpoch(str)
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// isEpoch returns whether str is a number which is long enough to be a time
+// since the epoch rather than a year or a date such as 20240501
+func isEpoch(str string) bool {
+	digits := 0
+	for i, r := range str {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '.' && i > 0:
+		case r == '-' && i == 0:
+		default:
+			return false
+		}
+	}
+	return digits >= 9
+}
+
+// parseEpoch parses a time since the epoch. Its unit is guessed from its
+// magnitude: anything before the year 5000 in seconds is taken as seconds,
+// and so on for milliseconds, microseconds and nanoseconds
+func parseEpoch(str string) (time.Time, bool) {
+	if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+		abs := n
+		if abs < 0 {
+			abs = -abs
+		}
+		switch {
+		case abs < 1e11:
+			return time.Unix(n, 0).UTC(), true
+		case abs < 1e14:
+			return time.Unix(n/1e3, n%1e3*1e6).UTC(), true
+		case abs < 1e17:
+			return time.Unix(n/1e6, n%1e6*1e3).UTC(), true
+		default:
+			return time.Unix(0, n).UTC(), true
+		}
+	}
+
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	abs := math.Abs(f)
+	switch {
+	case abs < 1e11:
+	case abs < 1e14:
+		f /= 1e3
+	case abs < 1e17:
+		f /= 1e6
+	default:
+		f /= 1e9
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+}
+
+// rankLayouts returns the layouts sorted by how many of the timestamps
+// they can parse, so the layout of a file is tried first for every line
+func rankLayouts(layouts []string, timestamps []string) []string {
+	ranked := append([]string{}, layouts...)
+	counts := make(map[string]int)
+	for _, str := range timestamps {
+		if str == "" || isEpoch(str) {
+			continue
+		}
+		for _, layout := range ranked {
+			if _, err := time.Parse(layout, str); err == nil {
+				counts[layout]++
+				break
+			}
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return counts[ranked[i]] > counts[ranked[j]]
+	})
+	return ranked
+}
+
+// The ways timestamps can be displayed, set with the time option, in the
+// order they are cycled through
+var timeDisplayModes = []string{"utc", "local", "relative"}
+
+// validTimeDisplay returns whether mode is one of the time display modes
+func validTimeDisplay(mode string) bool {
+	for _, m := range timeDisplayModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// The layout of displayed timestamps
+const displayLayout = "2006-01-02 15:04:05.000"
+
+// formatTime returns the text of a timestamp in a display mode of the time
+// option
+func formatTime(t time.Time, mode string) string {
+	switch mode {
+	case "local":
+		return t.Local().Format(displayLayout)
+	case "relative":
+		return formatAgo(time.Since(t))
+	default:
+		return t.UTC().Format(displayLayout)
+	}
+}
+
+// inputLocation returns the time zone of the times typed at the prompts
+// and shown back in them, local time when timestamps are displayed in it
+// and UTC otherwise
+func inputLocation() *time.Location {
+	if GetOption("time") == "local" {
+		return time.Local
+	}
+	return time.UTC
+}
+
+// formatAgo returns how long ago something happened, such as "3m ago"
+func formatAgo(d time.Duration) string {
+	if d < 0 {
+		return "in " + roundDuration(-d)
+	}
+	if d < time.Second {
+		return "now"
+	}
+	return roundDuration(d) + " ago"
+}
+
+// roundDuration returns a duration in its largest whole unit
+func roundDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return strconv.Itoa(int(d/time.Second)) + "s"
+	case d < time.Hour:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	case d < 24*time.Hour:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	default:
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+}
+
+// formatDelta returns the time between two lines, such as "+12ms"
+func formatDelta(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	switch {
+	case d < time.Millisecond:
+		return sign + strconv.Itoa(int(d/time.Microsecond)) + "us"
+	case d < time.Second:
+		return sign + strconv.Itoa(int(d/time.Millisecond)) + "ms"
+	case d < time.Minute:
+		return sign + strconv.FormatFloat(d.Seconds(), 'f', 3, 64) + "s"
+	default:
+		return sign + d.Round(time.Second).String()
+	}
+}
+
+// The layouts accepted for a time of day without a date
+var timeOfDayLayouts = []string{
+	"15:04",
+	"15:04:05",
+	"15:04:05.999999999",
+}
+
+// ParseTimeInput parses a time typed by the user. It may be
+//
+//	now
+//	a duration relative to now such as -15m, -2h30m or -1d
+//	a time of day such as 14:32 or 14:32:05, on the same day as ref
+//	a full timestamp such as 2024-05-01T14:32Z
+//
+// A time of day is in local time when timestamps are displayed in local
+// time, and in UTC otherwise
+func ParseTimeInput(str string, ref time.Time) (time.Time, error) {
+	str = strings.TrimSpace(str)
+	if str == "now" {
+		return time.Now(), nil
+	}
+
+	if strings.HasPrefix(str, "-") || strings.HasPrefix(str, "+") {
+		if d, ok := parseRelative(str); ok {
+			return time.Now().Add(d), nil
+		}
+	}
+
+	for _, layout := range timeOfDayLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			if ref.IsZero() {
+				ref = time.Now()
+			}
+			loc := inputLocation()
+			y, m, d := ref.In(loc).Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), nil
+		}
+	}
+
+	if t, ok := parseTimestamp(str); ok {
+		return t, nil
+	}
+	return time.Time{}, errors.New("cannot understand the time " + strconv.Quote(str))
+}
+
+// parseRelative parses a signed duration, which unlike time.ParseDuration
+// also accepts days
+func parseRelative(str string) (time.Duration, bool) {
+	if strings.HasSuffix(str, "d") {
+		days, err := strconv.ParseFloat(str[:len(str)-1], 64)
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(days * float64(24*time.Hour)), true
+	}
+	d, err := time.ParseDuration(str)
+	return d, err == nil
+}
+
+// ParseTimeWindow parses a time window written as since..until where
+// either side may be left empty, e.g. "14:00..14:30" or "-15m.."
+func ParseTimeWindow(str string, ref time.Time) (since, until time.Time, err error) {
+	parts := strings.SplitN(str, "..", 2)
+	if len(parts) != 2 {
+		return since, until, errors.New("a time window is written since..until")
+	}
+	if s := strings.TrimSpace(parts[0]); s != "" {
+		if since, err = ParseTimeInput(s, ref); err != nil {
+			return
+		}
+	}
+	if s := strings.TrimSpace(parts[1]); s != "" {
+		if until, err = ParseTimeInput(s, ref); err != nil {
+			return
+		}
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		err = errors.New("the end of the time window is before its start")
+	}
+	return
+}
+
+// formatTimeWindow returns the text of a time window as ParseTimeWindow
+// reads it, in the time zone the times are typed in
+func formatTimeWindow(since, until time.Time) string {
+	str := ""
+	if !since.IsZero() {
+		str += since.In(inputLocation()).Format(time.RFC3339)
+	}
+	str += ".."
+	if !until.IsZero() {
+		str += until.In(inputLocation()).Format(time.RFC3339)
+	}
+	return str
+}
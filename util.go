@@ -48,6 +48,14 @@ func Min(a, b int) int {
 	return a
 }
 
+// Min64 takes the min of two int64s
+func Min64(a, b int64) int64 {
+	if a > b {
+		return b
+	}
+	return a
+}
+
 // Max takes the max of two ints
 func Max(a, b int) int {
 	if a > b {
@@ -62,6 +70,16 @@ func FSize(f *os.File) int64 {
 	return fi.Size()
 }
 
+// isTerminal returns whether the given file is a terminal rather than
+// a pipe or a regular file
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
 // IsWordChar returns whether or not the string is a 'word character'
 // If it is a unicode character, then it does not match
 // Word characters are defined as [A-Za-z0-9_]
@@ -393,7 +411,7 @@ func PadLeft(str, pad string, lenght int) string {
 	for {
 		str = pad + str
 		if len(str) > lenght {
-			return str[0:lenght]
+			return str[len(str)-lenght:]
 		}
 	}
 }
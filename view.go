@@ -57,6 +57,8 @@ type View struct {
 	Num int
 	// What tab is this view stored in
 	TabNum int
+	// The leaf holding this view in the split tree of its tab
+	splitNode *LeafNode
 
 	// The buffer
 	Buf *Buffer
@@ -89,6 +91,39 @@ type View struct {
 	tripleClick bool
 
 	cellview *CellView
+
+	// The pane showing the selected entry, nil when it is closed
+	detail *DetailPane
+
+	// The filter hiding the lines that don't match it, nil if there is none
+	filter *Query
+	// Only lines with a timestamp in this window are shown, a zero time
+	// leaves that side of the window open
+	since, until time.Time
+	// Lines less severe than this are hidden, lines without a known level
+	// are always shown
+	minLevel Level
+	// The merged files whose lines are hidden
+	hiddenSources map[*Source]bool
+	// Maps the rows of the view to the lines of the buffer
+	index *RowIndex
+
+	// The last search, repeated by FindNext and FindPrevious
+	lastSearch string
+	// The rows matching the search
+	matches SearchMatches
+	// Incremented to cancel the count running in the background
+	matchCount int64
+	// The search for the next match running in the background, nil when
+	// there is none
+	finding *FindJob
+	// Incremented to cancel the search for the next match
+	findCount int64
+	// The parse summary being made in the background, nil when there is
+	// none
+	summarizing *SummaryJob
+	// Incremented to cancel the parse summary
+	summaryCount int64
 }
 
 // NewView returns a new fullscreen view
@@ -108,8 +143,6 @@ func NewViewWidthHeight(buf *Buffer, w, h int) *View {
 	v.Height = h
 	v.cellview = new(CellView)
 
-	v.ToggleTabbar()
-
 	v.OpenBuffer(buf)
 
 	v.messages = make(map[string][]GutterMessage)
@@ -118,9 +151,10 @@ func NewViewWidthHeight(buf *Buffer, w, h int) *View {
 		view: v,
 	}
 
-	// if v.Buf.Settings["statusline"].(bool) {
-	if true {
-		v.Height -= 2
+	// The messenger takes the last row of the screen
+	v.Height--
+	if v.Buf.Settings["statusline"].(bool) {
+		v.Height--
 	}
 
 	Log.Println("Height", v.Height)
@@ -129,21 +163,52 @@ func NewViewWidthHeight(buf *Buffer, w, h int) *View {
 }
 
 // ToggleStatusLine creates an extra row for the statusline if necessary
+// The detail pane is laid out again around the new statusline
 func (v *View) ToggleStatusLine() {
-	// if v.Buf.Settings["statusline"].(bool) {
-	if true {
+	if v.detail != nil {
+		v.detail.Close()
+	}
+	if v.Buf.Settings["statusline"].(bool) {
 		v.Height--
 	} else {
 		v.Height++
 	}
+	if v.detail != nil {
+		v.detail.Layout()
+	}
 }
 
-// ToggleTabbar creates an extra row for the tabbar if necessary
-func (v *View) ToggleTabbar() {
-	if v.y == 1 {
-		v.y = 0
-		v.Height++
+// statuslineRows returns how many rows the statusline of the view takes
+func (v *View) statuslineRows() int {
+	if v.Buf.Settings["statusline"].(bool) {
+		return 1
+	}
+	return 0
+}
+
+// SetLayout places the view on the screen, the height includes the
+// statusline. The detail pane is laid out again in the new space and the
+// view scrolls to keep the selected line in sight
+func (v *View) SetLayout(x, y, width, height int) {
+	if v.detail != nil {
+		v.detail.Close()
+	}
+	v.x, v.y = x, y
+	v.Width = width
+	v.Height = height - v.statuslineRows()
+	if v.detail != nil {
+		v.detail.Layout()
+	}
+	v.Relocate()
+}
+
+// dividerWidth returns how many columns the divider on the left of the view
+// takes, only views with another view on their left have one
+func (v *View) dividerWidth() int {
+	if v.x != 0 {
+		return 1
 	}
+	return 0
 }
 
 // ScrollUp scrolls the view up n lines (if possible)
@@ -159,9 +224,9 @@ func (v *View) ScrollUp(n int) {
 // ScrollDown scrolls the view down n lines (if possible)
 func (v *View) ScrollDown(n int) {
 	// Try to scroll by n but if it would overflow, scroll by 1
-	if v.Topline+n <= v.Buf.NumLines {
+	if v.Topline+n <= v.NumRows() {
 		v.Topline += n
-	} else if v.Topline < v.Buf.NumLines-1 {
+	} else if v.Topline < v.NumRows()-1 {
 		v.Topline++
 	}
 }
@@ -178,8 +243,15 @@ func (v *View) CanClose() bool {
 func (v *View) OpenBuffer(buf *Buffer) {
 	screen.Clear()
 	v.CloseBuffer()
+	old := v.Buf
 	v.Buf = buf
-	v.Line = buf.Y
+	if old != nil && old.Settings["statusline"] != buf.Settings["statusline"] {
+		v.ToggleStatusLine()
+	}
+	v.hiddenSources = nil
+	v.index = NewRowIndex(buf)
+	v.index.SetFilter(v.rowFilter())
+	v.Line = v.RowOf(buf.Y)
 	v.Topline = 0
 	v.leftCol = 0
 	v.Relocate()
@@ -193,30 +265,46 @@ func (v *View) OpenBuffer(buf *Buffer) {
 
 // Open opens the given file in the view
 func (v *View) Open(filename string) {
+	if buf := LoadFile(filename); buf != nil {
+		v.OpenBuffer(buf)
+	}
+}
+
+// LoadFile creates a buffer for a file, telling the user what went wrong
+// if it can't be read. nil is returned if the file couldn't be opened
+func LoadFile(filename string) *Buffer {
 	filename = ReplaceHome(filename)
 	file, err := os.Open(filename)
-	fileInfo, _ := os.Stat(filename)
+	if err != nil {
+		messenger.Error(err.Error())
+		return nil
+	}
+	defer file.Close()
 
-	if err == nil && fileInfo.IsDir() {
+	if fileInfo, _ := file.Stat(); fileInfo != nil && fileInfo.IsDir() {
 		messenger.Error(filename, " is a directory")
-		return
+		return nil
 	}
 
-	defer file.Close()
-
-	var buf *Buffer
+	buf, _, err := NewBufferFromFile(file, filename)
 	if err != nil {
-		messenger.Message(err.Error())
-		// File does not exist -- create an empty buffer with that name
-		buf = NewBufferFromString("", filename)
-	} else {
-		buf = NewBuffer(file, FSize(file), filename)
+		messenger.Error("Error reading ", filename, ": ", err)
 	}
-	v.OpenBuffer(buf)
+	return buf
 }
 
 // CloseBuffer performs any closing functions on the buffer
+// The buffer is left open while another split shows it
 func (v *View) CloseBuffer() {
+	if v.Buf == nil {
+		return
+	}
+	for _, other := range allViews() {
+		if other != v && other.Buf == v.Buf {
+			return
+		}
+	}
+	v.Buf.Close()
 }
 
 // ReOpen reloads the current buffer
@@ -229,35 +317,252 @@ func (v *View) ReOpen() {
 }
 
 // HSplit opens a horizontal split with the given buffer
-func (v *View) HSplit(buf *Buffer) {
-	// i := 0
-	// if v.Buf.Settings["splitBottom"].(bool) {
-	// 	i = 1
-	// }
-	// v.splitNode.HSplit(buf, v.Num+i)
+func (v *View) HSplit(buf *Buffer) *View {
+	i := v.splitNode.Position(HorizontalSplit)
+	if GetOption("splitbottom").(bool) {
+		i++
+	}
+	return v.HSplitIndex(buf, i)
 }
 
 // VSplit opens a vertical split with the given buffer
-func (v *View) VSplit(buf *Buffer) {
-	// i := 0
-	// if v.Buf.Settings["splitRight"].(bool) {
-	// 	i = 1
-	// }
-	// v.splitNode.VSplit(buf, v.Num+i)
+func (v *View) VSplit(buf *Buffer) *View {
+	i := v.splitNode.Position(VerticalSplit)
+	if GetOption("splitright").(bool) {
+		i++
+	}
+	return v.VSplitIndex(buf, i)
 }
 
 // HSplitIndex opens a horizontal split with the given buffer at the given index
-func (v *View) HSplitIndex(buf *Buffer, splitIndex int) {
-	// v.splitNode.HSplit(buf, splitIndex)
+func (v *View) HSplitIndex(buf *Buffer, splitIndex int) *View {
+	nv := v.splitNode.Split(HorizontalSplit, buf, splitIndex)
+	tabs[v.TabNum].Update(nv)
+	return nv
 }
 
 // VSplitIndex opens a vertical split with the given buffer at the given index
-func (v *View) VSplitIndex(buf *Buffer, splitIndex int) {
-	// v.splitNode.VSplit(buf, splitIndex)
+func (v *View) VSplitIndex(buf *Buffer, splitIndex int) *View {
+	nv := v.splitNode.Split(VerticalSplit, buf, splitIndex)
+	tabs[v.TabNum].Update(nv)
+	return nv
+}
+
+// NumRows returns the number of lines the view shows
+func (v *View) NumRows() int {
+	return v.index.Len()
+}
+
+// BufLine returns the buffer line shown at a row of the view
+func (v *View) BufLine(row int) int {
+	return v.index.Line(row)
+}
+
+// RowOf returns the row showing a buffer line. If the line is hidden by
+// the filter the row of the next line that is shown is returned
+func (v *View) RowOf(line int) int {
+	return v.index.Row(line)
+}
+
+// SetFilter hides the lines that don't match the query, or shows all the
+// lines again if the query is nil. The selected line stays selected if it
+// is still shown
+func (v *View) SetFilter(q *Query) {
+	v.filter = q
+	v.refilter()
+}
+
+// SetTimeWindow only shows the lines with a timestamp between since and
+// until. A zero time leaves that side of the window open
+func (v *View) SetTimeWindow(since, until time.Time) {
+	v.since, v.until = since, until
+	v.refilter()
+}
+
+// HasTimeWindow returns whether lines are filtered by time
+func (v *View) HasTimeWindow() bool {
+	return !v.since.IsZero() || !v.until.IsZero()
+}
+
+// SetMinLevel hides the lines less severe than l
+func (v *View) SetMinLevel(l Level) {
+	v.minLevel = l
+	v.refilter()
+}
+
+// ToggleSource hides the lines of a merged file, or shows them again
+func (v *View) ToggleSource(s *Source) {
+	if v.hiddenSources[s] {
+		delete(v.hiddenSources, s)
+	} else {
+		if v.hiddenSources == nil {
+			v.hiddenSources = make(map[*Source]bool)
+		}
+		v.hiddenSources[s] = true
+	}
+	v.refilter()
+}
+
+// ShownSources returns the names of the merged files whose lines are shown
+func (v *View) ShownSources() []string {
+	var names []string
+	for _, s := range v.Buf.Sources {
+		if !v.hiddenSources[s] {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// Filtered returns whether the view hides some of the lines of its buffer
+func (v *View) Filtered() bool {
+	return v.filter != nil || v.HasTimeWindow() || v.minLevel != LevelUnknown || len(v.hiddenSources) > 0
+}
+
+// refilter rebuilds the index after the filters changed, keeping the
+// selected line selected if it is still shown
+func (v *View) refilter() {
+	line := v.BufLine(v.Line)
+	v.index.SetFilter(v.rowFilter())
+	v.Line = v.RowOf(line)
+}
+
+// rowFilter returns the function deciding which lines the view shows. It
+// keeps its own copy of the filters of the view, the lines of an indexed
+// file are checked in the background
+func (v *View) rowFilter() func(line *Line) bool {
+	var filters []func(line *Line) bool
+	if v.filter != nil {
+		filters = append(filters, v.filter.Match)
+	}
+	if v.HasTimeWindow() {
+		filters = append(filters, inTimeWindow(v.since, v.until))
+	}
+	if v.minLevel != LevelUnknown {
+		filters = append(filters, atMinLevel(v.minLevel))
+	}
+	if len(v.hiddenSources) > 0 {
+		hidden := make(map[*Source]bool, len(v.hiddenSources))
+		for source, h := range v.hiddenSources {
+			hidden[source] = h
+		}
+		filters = append(filters, fromShownSource(hidden))
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	}
+	return func(line *Line) bool {
+		for _, f := range filters {
+			if !f(line) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// inTimeWindow returns a filter telling whether the line has a timestamp
+// inside the time window. Going line by line rather than cutting the buffer
+// at two points works for files that are not entirely sorted
+func inTimeWindow(since, until time.Time) func(line *Line) bool {
+	return func(line *Line) bool {
+		t, ok := line.Time()
+		if !ok {
+			return false
+		}
+		return (since.IsZero() || !t.Before(since)) && (until.IsZero() || !t.After(until))
+	}
+}
+
+// atMinLevel returns a filter telling whether the line is at least as
+// severe as the minimum level
+func atMinLevel(minLevel Level) func(line *Line) bool {
+	return func(line *Line) bool {
+		l := line.entry.severity
+		return l == LevelUnknown || l >= minLevel
+	}
+}
+
+// fromShownSource returns a filter telling whether the line comes from a
+// file that isn't hidden
+func fromShownSource(hidden map[*Source]bool) func(line *Line) bool {
+	return func(line *Line) bool {
+		return !hidden[line.source]
+	}
+}
+
+// rowTime returns the time of the first row from row up to end (excluded)
+// that has a timestamp, and that row
+func (v *View) rowTime(row, end int) (time.Time, int, bool) {
+	for ; row < end; row++ {
+		line := v.Buf.Line(v.BufLine(row))
+		if t, ok := line.Time(); ok {
+			return t, row, true
+		}
+	}
+	return time.Time{}, end, false
+}
+
+// How far around the result of the binary search FindTime looks for
+// entries that are out of order
+const timeSearchWindow = 1000
+
+// FindTime returns the row of the first entry at or after t. The rows are
+// binary searched by timestamp, which gets close enough in files that are
+// mostly sorted, then the rows around the result are checked for the
+// earliest time that is not before t
+func (v *View) FindTime(t time.Time) int {
+	numRows := v.NumRows()
+	lo, hi := 0, numRows
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		rt, row, ok := v.rowTime(mid, hi)
+		if !ok {
+			// Nothing between mid and hi has a time, look before mid
+			hi = mid
+		} else if rt.Before(t) {
+			lo = row + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	best, bestTime := -1, time.Time{}
+	for row := Max(lo-timeSearchWindow, 0); row < Min(lo+timeSearchWindow, numRows); row++ {
+		line := v.Buf.Line(v.BufLine(row))
+		rt, ok := line.Time()
+		if !ok || rt.Before(t) {
+			continue
+		}
+		if best < 0 || rt.Before(bestTime) {
+			best, bestTime = row, rt
+		}
+	}
+	if best < 0 {
+		return Min(lo, numRows-1)
+	}
+	return best
+}
+
+// CurrentTime returns the time of the selected line, or of the first line
+// after it which has a timestamp. It is used to fill in the date of times
+// typed without one
+func (v *View) CurrentTime() time.Time {
+	t, _, _ := v.rowTime(v.Line, v.NumRows())
+	return t
 }
 
 func (v *View) Bottomline() int {
-	return v.Topline + v.Height
+	return v.Topline + v.listHeight()
+}
+
+// listHeight returns how many rows fit in the view below the column header
+func (v *View) listHeight() int {
+	return Max(v.Height-1, 0)
 }
 
 // Relocate moves the view window so that the cursor is in view
@@ -266,7 +571,7 @@ func (v *View) Relocate() bool {
 	height := v.Bottomline() - v.Topline
 	ret := false
 	cy := v.Line
-	scrollmargin := 3
+	scrollmargin := int(GetOption("scrollmargin").(float64))
 	if cy < v.Topline+scrollmargin && cy > scrollmargin-1 {
 		v.Topline = cy - scrollmargin
 		ret = true
@@ -274,17 +579,48 @@ func (v *View) Relocate() bool {
 		v.Topline = cy
 		ret = true
 	}
-	if cy > v.Topline+height-1-scrollmargin && cy < v.Buf.NumLines-scrollmargin {
+	if cy > v.Topline+height-1-scrollmargin && cy < v.NumRows()-scrollmargin {
 		v.Topline = cy - height + 1 + scrollmargin
 		ret = true
-	} else if cy >= v.Buf.NumLines-scrollmargin && cy > height {
-		v.Topline = v.Buf.NumLines - height
+	} else if cy >= v.NumRows()-scrollmargin && cy > height {
+		v.Topline = v.NumRows() - height
 		ret = true
 	}
 
+	if v.Buf.Settings["softwrap"].(bool) {
+		// Wrapped rows take more than a line, scroll further until the
+		// cursor's row fits
+		for v.Topline < cy && v.wrappedLines(v.Topline, cy) > height {
+			v.Topline++
+			ret = true
+		}
+	}
+
 	return ret
 }
 
+// wrappedLines returns how many lines the rows from start to end take when
+// they are wrapped
+func (v *View) wrappedLines(start, end int) int {
+	width := v.Width - v.dividerWidth() - v.lineNumOffset
+	n := 0
+	for row := start; row <= end && row < v.NumRows(); row++ {
+		line := v.Buf.Line(v.BufLine(row))
+		var prev *Line
+		if row > 0 {
+			prevLine := v.Buf.Line(v.BufLine(row - 1))
+			prev = &prevLine
+		}
+		lineStr, _ := formatLine(v.Buf.Columns(), &line, prev)
+		if width <= 0 {
+			n++
+		} else {
+			n += Max((StringWidth(lineStr, 0)+width-1)/width, 1)
+		}
+	}
+	return n
+}
+
 func (v *View) SetLine(y int) bool {
 	v.Line = y
 	return true
@@ -379,9 +715,9 @@ func (v *View) openHelp(helpPage string) {
 }
 
 func (v *View) DisplayView() {
-	// if v.Buf.Settings["softwrap"].(bool) && v.leftCol != 0 {
-	// 	v.leftCol = 0
-	// }
+	if v.Buf.Settings["softwrap"].(bool) && v.leftCol != 0 {
+		v.leftCol = 0
+	}
 
 	if v.Type == vtLog {
 		// Log views should always follow the cursor...
@@ -393,82 +729,117 @@ func (v *View) DisplayView() {
 	// so we can pad appropriately when displaying line numbers
 	maxLineNumLength := len(strconv.Itoa(v.Buf.NumLines))
 
+	displayLineNumber := true
+	lineNumberPadding := 1
+
 	v.lineNumOffset = 0
+	if displayLineNumber {
+		v.lineNumOffset = maxLineNumLength + 2*lineNumberPadding
+	}
+
+	UpdateMatches(v)
 
-	height := v.Height
+	height := v.listHeight()
 	width := v.Width
 	left := v.leftCol
 	top := v.Topline
 
-	v.cellview.Draw(v.Buf, top, height, left, width-v.lineNumOffset)
+	// A view with another one on its left is set apart by a divider
+	x := v.x
+	if divider := v.dividerWidth(); divider > 0 {
+		for y := 0; y <= height; y++ {
+			screen.SetContent(x, v.y+y, '│', nil, GetColor("divider"))
+		}
+		x += divider
+		width -= divider
+	}
 
-	displayLineNumber := true
-	lineNumberPadding := 1
-	realLineN := top - 1
-	visualLineN := 0
-	var line []*Char
-	for visualLineN, line = range v.cellview.lines {
+	v.cellview.Draw(v, top, height, left, width-v.lineNumOffset)
+
+	// The header is drawn above the rows, past the gutter
+	screenX := 0
+	for ; screenX < v.lineNumOffset; screenX++ {
+		screen.SetContent(x+screenX, v.y, ' ', nil, defStyle)
+	}
+	for _, ch := range v.cellview.header {
+		if ch != nil {
+			screen.SetContent(x+screenX, v.y, ch.drawChar, nil, ch.style)
+		}
+		screenX++
+	}
+	for ; screenX < width; screenX++ {
+		screen.SetContent(x+screenX, v.y, ' ', nil, defStyle)
+	}
+
+	for visualLineN, line := range v.cellview.lines {
 		screenX := 0
-		realLineN++
+		realLineN := v.cellview.rows[visualLineN]
 		if displayLineNumber {
-			lineNumStyle := defStyle
-			lineNum := strconv.Itoa(realLineN + 1)
+			lineNumStyle := GetColor("gutter")
+			// Filtered views still show the line numbers in the file
+			lineNum := strconv.Itoa(v.BufLine(realLineN) + 1)
+			if visualLineN > 0 && v.cellview.rows[visualLineN-1] == realLineN {
+				// Only the first line of a wrapped row has a number
+				lineNum = ""
+			}
 
 			// padding before
 			for i := 0; i < lineNumberPadding; i++ {
-				screen.SetContent(screenX, visualLineN, ' ', nil, lineNumStyle)
+				screen.SetContent(x+screenX, v.y+1+visualLineN, ' ', nil, lineNumStyle)
 				screenX++
 			}
 			for i := 0; i < maxLineNumLength-len(lineNum); i++ {
-				screen.SetContent(screenX, visualLineN, ' ', nil, lineNumStyle)
+				screen.SetContent(x+screenX, v.y+1+visualLineN, ' ', nil, lineNumStyle)
 				screenX++
 			}
 
 			for _, ch := range lineNum {
-				screen.SetContent(screenX, visualLineN, ch, nil, lineNumStyle)
+				screen.SetContent(x+screenX, v.y+1+visualLineN, ch, nil, lineNumStyle)
 				screenX++
 			}
 
 			// padding after
 			for i := 0; i < lineNumberPadding; i++ {
-				screen.SetContent(screenX, visualLineN, ' ', nil, lineNumStyle)
+				screen.SetContent(x+screenX, v.y+1+visualLineN, ' ', nil, lineNumStyle)
 				screenX++
 			}
 		}
 		lineStyle := defStyle
 		if v.Line == realLineN {
-			lineStyle = defStyle.Reverse(true)
+			lineStyle = GetColor("selection")
 		}
 		for _, ch := range line {
 			// charStyle := lineStyle
 			// if ch.style != nil {
 			// }
 			charStyle := ch.style
-			if v.Line == realLineN {
-				charStyle = defStyle.Reverse(true)
+			if v.Line == realLineN && !ch.match {
+				charStyle = lineStyle
 			}
-			screen.SetContent(screenX, visualLineN, ch.drawChar, nil, charStyle)
+			screen.SetContent(x+screenX, v.y+1+visualLineN, ch.drawChar, nil, charStyle)
 			screenX++
 		}
 		for screenX < width {
-			screen.SetContent(screenX, visualLineN, ' ', nil, lineStyle)
+			screen.SetContent(x+screenX, v.y+1+visualLineN, ' ', nil, lineStyle)
 			screenX++
 		}
 	}
 }
 
 // Display renders the view, the cursor, and statusline
+// Nothing is drawn when the screen is too small to fit the view
 func (v *View) Display() {
-	// if globalSettings["termtitle"].(bool) {
-	screen.SetTitle("micro: " + v.Buf.GetName())
-	// }
+	if v.Width <= 0 || v.Height < 0 {
+		return
+	}
+	if GetOption("termtitle").(bool) {
+		screen.SetTitle("jv: " + v.Buf.GetName())
+	}
 	v.DisplayView()
-	// _, screenH := screen.Size()
-	// if v.Buf.Settings["statusline"].(bool) {
-	v.sline.Display()
-	// } else if (v.y + v.Height) != screenH-1 {
-	// for x := 0; x < v.Width; x++ {
-	// 	screen.SetContent(v.x+x, v.y+v.Height, '-', nil, defStyle.Reverse(true))
-	// }
-	// }
+	if v.Buf.Settings["statusline"].(bool) {
+		v.sline.Display()
+	}
+	if v.detail != nil {
+		v.detail.Display()
+	}
 }